@@ -4,75 +4,62 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"os"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
+
+	"on-air/secrets"
 )
 
-// tokenFromFile reads an OAuth2 token from a file.
-func tokenFromFile(file string) (*oauth2.Token, error) {
-	f, err := os.Open(file)
+// tokenFromFile reads an OAuth2 token from a file in store.
+func tokenFromFile(store secrets.Store, file string) (*oauth2.Token, error) {
+	b, err := store.Load(file)
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		cerr := f.Close()
-		if cerr != nil {
-			log.Printf("error closing token file: %v", cerr)
-		}
-	}()
 	tok := &oauth2.Token{}
-	if err := json.NewDecoder(f).Decode(tok); err != nil {
+	if err := json.Unmarshal(b, tok); err != nil {
 		return nil, err
 	}
 	return tok, nil
 }
 
-// saveToken saves an OAuth2 token to a file.
-func saveToken(path string, token *oauth2.Token) error {
-	f, err := os.Create(path)
+// saveToken saves an OAuth2 token to a file in store, readable only by us.
+func saveToken(store secrets.Store, path string, token *oauth2.Token) error {
+	b, err := json.Marshal(token)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		cerr := f.Close()
-		if cerr != nil {
-			log.Printf("error closing token file: %v", cerr)
-		}
-	}()
-	return json.NewEncoder(f).Encode(token)
+	return store.Save(path, b)
 }
 
-// GetClient returns an authenticated HTTP client using credentials and token files.
-func GetClient(ctx context.Context, credsPath, tokenPath, scope string) (*http.Client, error) {
-	credBytes, err := os.ReadFile(credsPath)
+// configFromFile reads the OAuth client config from a Google credentials file in store.
+func configFromFile(store secrets.Store, credsPath string, scopes ...string) (*oauth2.Config, error) {
+	credBytes, err := store.Load(credsPath)
 	if err != nil {
 		return nil, err
 	}
-	config, err := google.ConfigFromJSON(credBytes, scope)
+	return google.ConfigFromJSON(credBytes, scopes...)
+}
+
+// ErrNoToken is returned by GetClient when there is no token to use. Logging in
+// is interactive, so it's left to `on-air auth login` rather than done here.
+var ErrNoToken = errors.New("no token")
+
+// GetClient returns an authenticated HTTP client using the credentials and token
+// files in store.
+func GetClient(ctx context.Context, store secrets.Store, credsPath, tokenPath string, scopes ...string) (*http.Client, error) {
+	config, err := configFromFile(store, credsPath, scopes...)
 	if err != nil {
 		return nil, err
 	}
-	tok, err := tokenFromFile(tokenPath)
+	tok, err := tokenFromFile(store, tokenPath)
 	if err != nil {
-		// Token not found, get one from web
-		url := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-		log.Printf("Go to the following link in your browser then type the authorization code: \n%v\n", url)
-		var code string
-		if _, err := fmt.Scan(&code); err != nil {
-			return nil, err
-		}
-		tok, err = config.Exchange(ctx, code)
-		if err != nil {
-			return nil, err
-		}
-		if err := saveToken(tokenPath, tok); err != nil {
-			return nil, err
-		}
+		return nil, fmt.Errorf("%w at %s, run `on-air auth login`: %w", ErrNoToken, tokenPath, err)
 	}
-	return config.Client(ctx, tok), nil
+	ts := PersistingTokenSource(config.TokenSource(ctx, tok), store, tokenPath, tok)
+	return oauth2.NewClient(ctx, ts), nil
 }
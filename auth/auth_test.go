@@ -1,11 +1,17 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"golang.org/x/oauth2"
+
+	"on-air/secrets"
 )
 
 func TestSaveAndTokenFromFile(t *testing.T) {
@@ -20,12 +26,12 @@ func TestSaveAndTokenFromFile(t *testing.T) {
 	}
 
 	// Test saveToken
-	if err := saveToken(tmpFile, token); err != nil {
+	if err := saveToken(secrets.FileStore{}, tmpFile, token); err != nil {
 		t.Fatalf("saveToken failed: %v", err)
 	}
 
 	// Test tokenFromFile
-	readToken, err := tokenFromFile(tmpFile)
+	readToken, err := tokenFromFile(secrets.FileStore{}, tmpFile)
 	if err != nil {
 		t.Fatalf("tokenFromFile failed: %v", err)
 	}
@@ -45,8 +51,23 @@ func TestSaveAndTokenFromFile(t *testing.T) {
 }
 
 func TestTokenFromFileNotFound(t *testing.T) {
-	_, err := tokenFromFile("nonexistent_token.json")
+	_, err := tokenFromFile(secrets.FileStore{}, "nonexistent_token.json")
 	if err == nil {
 		t.Error("expected error for nonexistent file, got nil")
 	}
 }
+
+func TestGetClient_NoToken(t *testing.T) {
+	dir := t.TempDir()
+	creds := filepath.Join(dir, "credentials.json")
+	data := `{"installed":{"client_id":"id","client_secret":"secret","auth_uri":"https://accounts.google.com/o/oauth2/auth","token_uri":"https://oauth2.googleapis.com/token","redirect_uris":["http://localhost"]}}`
+	if err := os.WriteFile(creds, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a token it fails right away instead of waiting for a browser login.
+	_, err := GetClient(context.Background(), secrets.FileStore{}, creds, filepath.Join(dir, "token.json"))
+	if !errors.Is(err, ErrNoToken) || !strings.Contains(err.Error(), "on-air auth login") {
+		t.Errorf("got %v, want ErrNoToken pointing at auth login", err)
+	}
+}
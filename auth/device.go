@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	"on-air/secrets"
+)
+
+// DeviceLogin runs the device authorization grant (RFC 8628) for machines without a browser.
+// prompt is called with the user code and verification URL to show to the user, then the
+// token endpoint is polled until they approve, backing off when told to slow down.
+func DeviceLogin(ctx context.Context, config *oauth2.Config, prompt func(*oauth2.DeviceAuthResponse)) (*oauth2.Token, error) {
+	da, err := config.DeviceAuth(ctx, oauth2.AccessTypeOffline)
+	if err != nil {
+		return nil, fmt.Errorf("device authorization: %w", err)
+	}
+	prompt(da)
+	tok, err := config.DeviceAccessToken(ctx, da)
+	if err != nil {
+		return nil, fmt.Errorf("device token: %w", err)
+	}
+	return tok, nil
+}
+
+// Login authorizes on-air with the OAuth client in credsPath and saves the token to
+// tokenPath, both in store.
+// With device set it uses the device authorization grant, otherwise the loopback flow,
+// opening a browser unless noBrowser is set.
+func Login(ctx context.Context, store secrets.Store, credsPath, tokenPath string, device, noBrowser bool, scopes ...string) error {
+	config, err := configFromFile(store, credsPath, scopes...)
+	if err != nil {
+		return err
+	}
+	if config.Endpoint.DeviceAuthURL == "" {
+		// Client JSON files don't carry the device endpoint.
+		config.Endpoint.DeviceAuthURL = google.Endpoint.DeviceAuthURL
+	}
+	var tok *oauth2.Token
+	if device {
+		tok, err = DeviceLogin(ctx, config, func(da *oauth2.DeviceAuthResponse) {
+			fmt.Printf("To authorize on-air, visit %s and enter the code %s\n", verificationURL(da), da.UserCode)
+		})
+	} else {
+		open := OpenBrowser
+		if noBrowser {
+			open = nil
+		}
+		tok, err = LoopbackLogin(ctx, config, open)
+	}
+	if err != nil {
+		return err
+	}
+	return saveToken(store, tokenPath, tok)
+}
+
+// verificationURL returns the URL the user should visit, preferring the one with the code filled in.
+func verificationURL(da *oauth2.DeviceAuthResponse) string {
+	if da.VerificationURIComplete != "" {
+		return da.VerificationURIComplete
+	}
+	return da.VerificationURI
+}
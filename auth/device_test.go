@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// fakeDeviceServer answers device code requests and replies to token polls with the given errors in turn,
+// issuing a token once they run out. It records when each poll arrived.
+func fakeDeviceServer(t *testing.T, replies ...string) (*httptest.Server, func() []time.Time) {
+	var mu sync.Mutex
+	var polls []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/device":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"device_code":      "device-code",
+				"user_code":        "ABCD-EFGH",
+				"verification_url": "https://example.com/device",
+				"expires_in":       60,
+				"interval":         1,
+			})
+		case "/token":
+			if r.Form.Get("device_code") != "device-code" {
+				t.Errorf("device_code: got %q", r.Form.Get("device_code"))
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			polls = append(polls, time.Now())
+			if len(polls) <= len(replies) {
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": replies[len(polls)-1]})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token":  "access",
+				"refresh_token": "refresh",
+				"token_type":    "Bearer",
+				"expires_in":    3600,
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return srv, func() []time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]time.Time(nil), polls...)
+	}
+}
+
+func deviceConfig(srv *httptest.Server) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Endpoint: oauth2.Endpoint{
+			DeviceAuthURL: srv.URL + "/device",
+			TokenURL:      srv.URL + "/token",
+			// Auto-detection would retry each failed poll, skewing the poll count.
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+}
+
+func TestDeviceLogin(t *testing.T) {
+	srv, polls := fakeDeviceServer(t, "authorization_pending")
+	defer srv.Close()
+
+	var prompted *oauth2.DeviceAuthResponse
+	tok, err := DeviceLogin(context.Background(), deviceConfig(srv), func(da *oauth2.DeviceAuthResponse) { prompted = da })
+	if err != nil {
+		t.Fatalf("DeviceLogin failed: %v", err)
+	}
+	if prompted == nil || prompted.UserCode != "ABCD-EFGH" || verificationURL(prompted) != "https://example.com/device" {
+		t.Errorf("unexpected prompt: %+v", prompted)
+	}
+	if tok.AccessToken != "access" || tok.RefreshToken != "refresh" {
+		t.Errorf("unexpected token: %+v", tok)
+	}
+	if n := len(polls()); n != 2 {
+		t.Errorf("expected 2 polls, got %d", n)
+	}
+}
+
+func TestDeviceLogin_SlowDown(t *testing.T) {
+	if testing.Short() {
+		t.Skip("slow_down adds 5 seconds to the poll interval")
+	}
+	srv, polls := fakeDeviceServer(t, "slow_down")
+	defer srv.Close()
+
+	if _, err := DeviceLogin(context.Background(), deviceConfig(srv), func(*oauth2.DeviceAuthResponse) {}); err != nil {
+		t.Fatalf("DeviceLogin failed: %v", err)
+	}
+	p := polls()
+	if len(p) != 2 {
+		t.Fatalf("expected 2 polls, got %d", len(p))
+	}
+	if gap := p[1].Sub(p[0]); gap < 5*time.Second {
+		t.Errorf("expected the poll interval to grow after slow_down, next poll came after %v", gap)
+	}
+}
+
+func TestDeviceLogin_Denied(t *testing.T) {
+	srv, _ := fakeDeviceServer(t, "access_denied")
+	defer srv.Close()
+
+	if _, err := DeviceLogin(context.Background(), deviceConfig(srv), func(*oauth2.DeviceAuthResponse) {}); err == nil {
+		t.Error("expected error when the user denies access, got nil")
+	}
+}
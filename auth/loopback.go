@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"on-air/logutil"
+)
+
+// callbackResult is what the loopback redirect handler received.
+type callbackResult struct {
+	code string
+	err  error
+}
+
+// LoopbackLogin runs the authorization code flow with a loopback redirect.
+// It listens on a random localhost port, sends the user to the consent page
+// with a PKCE challenge and a random state, and exchanges the code it gets back.
+// If open is non-nil it's used to open the consent page in a browser, the URL is
+// always logged so it can be opened by hand.
+func LoopbackLogin(ctx context.Context, config *oauth2.Config, open func(url string) error) (*oauth2.Token, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("listen for redirect: %w", err)
+	}
+	cfg := *config
+	cfg.RedirectURL = fmt.Sprintf("http://%s/", ln.Addr().String())
+
+	state, err := randomState()
+	if err != nil {
+		return nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	results := make(chan callbackResult, 1)
+	srv := &http.Server{
+		ReadHeaderTimeout: 5 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/" {
+				http.NotFound(w, r)
+				return
+			}
+			res := callback(r, state)
+			if res.err != nil {
+				http.Error(w, "Authorization failed: "+res.err.Error(), http.StatusBadRequest)
+			} else {
+				_, _ = fmt.Fprintln(w, "on-air is authorized, you can close this window.")
+			}
+			select {
+			case results <- res:
+			default:
+			}
+		}),
+	}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("redirect listener", logutil.Err(err))
+		}
+	}()
+	defer func() {
+		if err := srv.Close(); err != nil {
+			slog.Warn("close redirect listener", logutil.Err(err))
+		}
+	}()
+
+	url := cfg.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier))
+	fmt.Printf("Go to the following link in your browser to authorize on-air:\n%v\n", url)
+	if open != nil {
+		if err := open(url); err != nil {
+			slog.Warn("could not open browser", logutil.Err(err))
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-results:
+		if res.err != nil {
+			return nil, res.err
+		}
+		return cfg.Exchange(ctx, res.code, oauth2.VerifierOption(verifier))
+	}
+}
+
+// callback checks the redirect request against the expected state and returns its code.
+func callback(r *http.Request, state string) callbackResult {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		return callbackResult{err: fmt.Errorf("authorization denied: %s", e)}
+	}
+	if q.Get("state") != state {
+		return callbackResult{err: errors.New("authorization state mismatch")}
+	}
+	code := q.Get("code")
+	if code == "" {
+		return callbackResult{err: errors.New("authorization code missing from redirect")}
+	}
+	return callbackResult{code: code}
+}
+
+// randomState returns an unguessable state parameter.
+func randomState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// OpenBrowser opens the URL in the user's default browser.
+func OpenBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"on-air/secrets"
+)
+
+// RevokeURL is Google's token revocation endpoint.
+var RevokeURL = "https://oauth2.googleapis.com/revoke"
+
+// Logout deletes the saved token, so the next run has to authorize again.
+// The grant itself stays valid, see Revoke.
+func Logout(tokenPath string) error {
+	if err := os.Remove(tokenPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Revoke revokes the grant of the token saved in store at Google, then deletes
+// the token. A token Google no longer knows about counts as revoked.
+func Revoke(ctx context.Context, store secrets.Store, tokenPath string) error {
+	tok, err := tokenFromFile(store, tokenPath)
+	if err != nil {
+		return err
+	}
+	// Revoking the refresh token revokes the whole grant, access tokens included.
+	t := tok.RefreshToken
+	if t == "" {
+		t = tok.AccessToken
+	}
+	body := strings.NewReader(url.Values{"token": {t}}.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, RevokeURL, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("revoke token: %w", err)
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK && !strings.Contains(string(msg), "invalid_token") {
+		return fmt.Errorf("revoke token: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return Logout(tokenPath)
+}
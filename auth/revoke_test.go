@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/oauth2"
+
+	"on-air/secrets"
+)
+
+func fakeRevokeServer(t *testing.T, status int, body string, got *string) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse revoke request: %v", err)
+		}
+		*got = r.Form.Get("token")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	old := RevokeURL
+	RevokeURL = srv.URL
+	t.Cleanup(func() { RevokeURL = old })
+}
+
+func TestRevoke(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		status  int
+		body    string
+		wantErr bool
+	}{
+		{"ok", http.StatusOK, "", false},
+		{"already revoked", http.StatusBadRequest, `{"error": "invalid_token"}`, false},
+		{"server error", http.StatusInternalServerError, "oops", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got string
+			fakeRevokeServer(t, tc.status, tc.body, &got)
+			file := filepath.Join(t.TempDir(), "token.json")
+			if err := saveToken(secrets.FileStore{}, file, &oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}); err != nil {
+				t.Fatal(err)
+			}
+
+			err := Revoke(context.Background(), secrets.FileStore{}, file)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Revoke: got %v, want error %v", err, tc.wantErr)
+			}
+			if got != "refresh" {
+				t.Errorf("revoked token: got %q, want the refresh token", got)
+			}
+			if _, statErr := os.Stat(file); os.IsNotExist(statErr) == tc.wantErr {
+				t.Errorf("token file kept: %v, want %v", statErr == nil, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "token.json")
+	if err := os.WriteFile(file, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Logout(file); err != nil {
+		t.Fatalf("Logout failed: %v", err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("token still there: %v", err)
+	}
+	if err := Logout(file); err != nil {
+		t.Errorf("Logout without a token: %v", err)
+	}
+}
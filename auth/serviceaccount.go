@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/oauth2/google"
+
+	"on-air/secrets"
+)
+
+// Mode selects how a calendar source authenticates to Google.
+type Mode string
+
+const (
+	// ModeOAuth uses an OAuth client and a user's token file (the default).
+	ModeOAuth Mode = "oauth"
+	// ModeServiceAccount uses a service-account JSON key, optionally impersonating
+	// a user through domain-wide delegation.
+	ModeServiceAccount Mode = "service_account"
+)
+
+// ServiceAccountClient returns an HTTP client authenticated with the service-account key in keyPath in store.
+// With a subject, the service account acts as that user, which needs domain-wide delegation for the
+// scopes. Without one it can only read calendars shared with the service account itself.
+func ServiceAccountClient(ctx context.Context, store secrets.Store, keyPath, subject string, scopes ...string) (*http.Client, error) {
+	key, err := store.Load(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	config, err := google.JWTConfigFromJSON(key, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("service account key: %w", err)
+	}
+	config.Subject = subject
+	return config.Client(ctx), nil
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"on-air/secrets"
+)
+
+// writeServiceAccountKey writes a service-account key using tokenURI and returns its path and public key.
+func writeServiceAccountKey(t *testing.T, tokenURI string) (string, *rsa.PublicKey) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	key, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "on-air@example.iam.gserviceaccount.com",
+		"private_key_id": "key-id",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":      tokenURI,
+	})
+	if err != nil {
+		t.Fatalf("marshal key file: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "service-account.json")
+	if err := os.WriteFile(path, key, 0600); err != nil {
+		t.Fatalf("write key file: %v", err)
+	}
+	return path, &priv.PublicKey
+}
+
+// fakeJWTServer verifies the signed assertion and checks its claims before issuing a token.
+func fakeJWTServer(t *testing.T, pub **rsa.PublicKey, wantSubject string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		if gt := r.Form.Get("grant_type"); gt != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			t.Errorf("grant_type: got %q", gt)
+		}
+		parts := strings.Split(r.Form.Get("assertion"), ".")
+		if len(parts) != 3 {
+			t.Fatalf("assertion is not a JWT: %q", r.Form.Get("assertion"))
+		}
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil {
+			t.Fatalf("decode signature: %v", err)
+		}
+		sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(*pub, crypto.SHA256, sum[:], sig); err != nil {
+			t.Errorf("assertion signature: %v", err)
+		}
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			t.Fatalf("decode claims: %v", err)
+		}
+		var claims map[string]interface{}
+		if err := json.Unmarshal(payload, &claims); err != nil {
+			t.Fatalf("unmarshal claims: %v", err)
+		}
+		if claims["iss"] != "on-air@example.iam.gserviceaccount.com" {
+			t.Errorf("iss: got %v", claims["iss"])
+		}
+		if claims["scope"] != "https://www.googleapis.com/auth/calendar.freebusy" {
+			t.Errorf("scope: got %v", claims["scope"])
+		}
+		if sub, _ := claims["sub"].(string); sub != wantSubject {
+			t.Errorf("sub: got %q, want %q", sub, wantSubject)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "sa-access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+}
+
+func TestServiceAccountClient(t *testing.T) {
+	for _, subject := range []string{"", "room@example.com"} {
+		var pub *rsa.PublicKey
+		tokenSrv := fakeJWTServer(t, &pub, subject)
+		keyPath, key := writeServiceAccountKey(t, tokenSrv.URL)
+		pub = key
+
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if got := r.Header.Get("Authorization"); got != "Bearer sa-access" {
+				t.Errorf("Authorization: got %q, want Bearer sa-access", got)
+			}
+		}))
+
+		client, err := ServiceAccountClient(context.Background(), secrets.FileStore{}, keyPath, subject, "https://www.googleapis.com/auth/calendar.freebusy")
+		if err != nil {
+			t.Fatalf("ServiceAccountClient failed: %v", err)
+		}
+		resp, err := client.Get(api.URL)
+		if err != nil {
+			t.Fatalf("request with service account: %v", err)
+		}
+		_ = resp.Body.Close()
+
+		api.Close()
+		tokenSrv.Close()
+	}
+}
+
+func TestServiceAccountClient_BadKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.json")
+	if err := os.WriteFile(path, []byte(`{"type": "authorized_user"}`), 0600); err != nil {
+		t.Fatalf("write key file: %v", err)
+	}
+	if _, err := ServiceAccountClient(context.Background(), secrets.FileStore{}, path, ""); err == nil {
+		t.Error("expected error for a key that isn't a service account, got nil")
+	}
+}
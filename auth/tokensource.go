@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"golang.org/x/oauth2"
+
+	"on-air/logutil"
+	"on-air/metrics"
+	"on-air/secrets"
+)
+
+// ErrRevoked is returned when Google rejects the refresh token, usually because
+// access was revoked or the grant expired. Only logging in again fixes it.
+var ErrRevoked = errors.New("oauth grant revoked or expired, log in again")
+
+// persistingTokenSource writes refreshed tokens back to the token file.
+type persistingTokenSource struct {
+	mu    sync.Mutex
+	src   oauth2.TokenSource
+	store secrets.Store
+	path  string
+	last  string // access token last written to path
+}
+
+// PersistingTokenSource wraps src so every newly refreshed token is saved to path
+// in store. tok is the token already stored at path. Refresh failures caused by a revoked
+// or expired grant are reported as ErrRevoked.
+func PersistingTokenSource(src oauth2.TokenSource, store secrets.Store, path string, tok *oauth2.Token) oauth2.TokenSource {
+	ts := &persistingTokenSource{src: src, store: store, path: path}
+	if tok != nil {
+		ts.last = tok.AccessToken
+	}
+	return ts
+}
+
+// Token returns the current token, saving it first if it was refreshed.
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tok, err := s.src.Token()
+	if err != nil {
+		var rerr *oauth2.RetrieveError
+		if errors.As(err, &rerr) && rerr.ErrorCode == "invalid_grant" {
+			return nil, fmt.Errorf("%w: %w", ErrRevoked, err)
+		}
+		return nil, err
+	}
+	if tok.AccessToken != s.last {
+		if err := saveToken(s.store, s.path, tok); err != nil {
+			// The token is still good for this process, so don't fail the request.
+			slog.Warn("save refreshed token", "path", s.path, logutil.Err(err))
+		} else {
+			slog.Debug("saved refreshed token", "path", s.path, "expiry", tok.Expiry)
+			s.last = tok.AccessToken
+		}
+	}
+	if !tok.Expiry.IsZero() {
+		metrics.TokenExpiry.WithLabelValues(s.path).Set(float64(tok.Expiry.Unix()))
+	}
+	return tok, nil
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"on-air/secrets"
+)
+
+func refreshServer(t *testing.T, status int, body interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(body); err != nil {
+			t.Errorf("json encode error: %v", err)
+		}
+	}))
+}
+
+func expired() *oauth2.Token {
+	return &oauth2.Token{AccessToken: "old", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Hour)}
+}
+
+func TestPersistingTokenSource_SavesRefreshedToken(t *testing.T) {
+	srv := refreshServer(t, http.StatusOK, map[string]interface{}{
+		"access_token": "new",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "token.json")
+	tok := expired()
+	if err := saveToken(secrets.FileStore{}, path, tok); err != nil {
+		t.Fatalf("saveToken failed: %v", err)
+	}
+	cfg := &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: srv.URL}}
+	ts := PersistingTokenSource(cfg.TokenSource(context.Background(), tok), secrets.FileStore{}, path, tok)
+
+	got, err := ts.Token()
+	if err != nil {
+		t.Fatalf("Token failed: %v", err)
+	}
+	if got.AccessToken != "new" {
+		t.Errorf("AccessToken: got %v, want new", got.AccessToken)
+	}
+	saved, err := tokenFromFile(secrets.FileStore{}, path)
+	if err != nil {
+		t.Fatalf("tokenFromFile failed: %v", err)
+	}
+	if saved.AccessToken != "new" || saved.RefreshToken != "refresh" {
+		t.Errorf("saved token not refreshed: %+v", saved)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat token file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("token file permissions: got %v, want 0600", perm)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".token.json-*"))
+	if len(leftovers) != 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestPersistingTokenSource_Revoked(t *testing.T) {
+	srv := refreshServer(t, http.StatusBadRequest, map[string]string{
+		"error":             "invalid_grant",
+		"error_description": "Token has been expired or revoked.",
+	})
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "token.json")
+	tok := expired()
+	cfg := &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: srv.URL}}
+	ts := PersistingTokenSource(cfg.TokenSource(context.Background(), tok), secrets.FileStore{}, path, tok)
+
+	_, err := ts.Token()
+	if !errors.Is(err, ErrRevoked) {
+		t.Errorf("expected ErrRevoked, got %v", err)
+	}
+}
+
+func TestPersistingTokenSource_OtherErrors(t *testing.T) {
+	srv := refreshServer(t, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+	defer srv.Close()
+
+	tok := expired()
+	cfg := &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: srv.URL}}
+	ts := PersistingTokenSource(cfg.TokenSource(context.Background(), tok), secrets.FileStore{}, filepath.Join(t.TempDir(), "token.json"), tok)
+
+	_, err := ts.Token()
+	if err == nil || errors.Is(err, ErrRevoked) {
+		t.Errorf("expected a non-revoked error, got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"on-air/auth"
+	"on-air/schedule"
+)
+
+// authCommand runs the "auth" subcommands.
+func authCommand(args []string) {
+	usage := "usage: on-air auth login [-device] [-no-browser] [-person name] [-config path]\n" +
+		"       on-air auth logout|revoke [-person name] [-config path]"
+	if len(args) == 0 || (args[0] != "login" && args[0] != "logout" && args[0] != "revoke") {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("auth "+args[0], flag.ExitOnError)
+	var (
+		configPath = configFlag(fs)
+		person     = fs.String("person", "", "person to log in as in shared-room mode")
+		device     *bool
+		noBrowser  *bool
+	)
+	if args[0] == "login" {
+		device = fs.Bool("device", false, "use the device authorization flow for machines without a browser")
+		noBrowser = fs.Bool("no-browser", false, "don't try to open a browser, just print the link")
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		log.Fatal(err)
+	}
+
+	cfg := loadConfig(*configPath, nil)
+	p, err := (&schedule.Manager{Settings: settings(cfg)}).Person(*person)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if p.Auth == auth.ModeServiceAccount {
+		log.Fatal("this source uses a service-account key, there is no token to manage")
+	}
+
+	switch args[0] {
+	case "login":
+		if err := auth.Login(context.Background(), p.Secrets, p.CredsPath, p.TokenPath, *device, *noBrowser, p.Scopes()...); err != nil {
+			log.Fatalf("login failed: %v", err)
+		}
+		fmt.Printf("Saved token to %s\n", p.TokenPath)
+	case "logout":
+		if err := auth.Logout(p.TokenPath); err != nil {
+			log.Fatalf("logout failed: %v", err)
+		}
+		fmt.Printf("Removed %s, the grant stays valid until it's revoked\n", p.TokenPath)
+	case "revoke":
+		if err := auth.Revoke(context.Background(), p.Secrets, p.TokenPath); err != nil {
+			log.Fatalf("revoke failed: %v", err)
+		}
+		fmt.Printf("Revoked the grant and removed %s\n", p.TokenPath)
+	}
+}
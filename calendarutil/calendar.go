@@ -3,16 +3,121 @@ package calendarutil
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
 
 	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+
+	"on-air/logutil"
+	"on-air/retry"
 )
 
-// QueryFreeBusy queries the FreeBusy endpoint for the given calendar ID and time range.
-func QueryFreeBusy(ctx context.Context, svc *calendar.Service, calID string, timeMin, timeMax string) (*calendar.FreeBusyResponse, error) {
+// QueryFreeBusy queries the FreeBusy endpoint for the given calendar IDs and time range.
+func QueryFreeBusy(ctx context.Context, svc *calendar.Service, calIDs []string, timeMin, timeMax string) (*calendar.FreeBusyResponse, error) {
+	items := make([]*calendar.FreeBusyRequestItem, 0, len(calIDs))
+	for _, id := range calIDs {
+		items = append(items, &calendar.FreeBusyRequestItem{Id: id})
+	}
 	req := &calendar.FreeBusyRequest{
 		TimeMin: timeMin,
 		TimeMax: timeMax,
-		Items:   []*calendar.FreeBusyRequestItem{{Id: calID}},
+		Items:   items,
+	}
+	return svc.Freebusy.Query(req).Context(ctx).Do()
+}
+
+// Accepted reports whether an event should count as busy for the calendar owner.
+// Cancelled, transparent ("show as available") and all-day events never count.
+// Events without attendees are our own and always count, otherwise our response must be "accepted".
+func Accepted(ev *calendar.Event) bool {
+	if ev.Status == "cancelled" || ev.Transparency == "transparent" {
+		return false
+	}
+	if ev.Start == nil || ev.Start.DateTime == "" || ev.End == nil || ev.End.DateTime == "" {
+		return false
+	}
+	if len(ev.Attendees) == 0 {
+		return true
+	}
+	for _, a := range ev.Attendees {
+		if a.Self {
+			return a.ResponseStatus == "accepted"
+		}
+	}
+	// We're not on the guest list, so this is someone else's event on a shared calendar.
+	return false
+}
+
+// WatchEvents opens a push notification channel for changes to the events on a calendar.
+// See https://developers.google.com/calendar/api/guides/push for the channel fields.
+func WatchEvents(ctx context.Context, svc *calendar.Service, calID string, ch *calendar.Channel) (*calendar.Channel, error) {
+	return svc.Events.Watch(calID, ch).Context(ctx).Do()
+}
+
+// StopChannel stops a push notification channel opened by WatchEvents.
+func StopChannel(ctx context.Context, svc *calendar.Service, ch *calendar.Channel) error {
+	return svc.Channels.Stop(ch).Context(ctx).Do()
+}
+
+// ErrFullSyncRequired is returned by SyncEvents when Google no longer accepts the
+// sync token (410 Gone), so the events have to be listed from scratch.
+var ErrFullSyncRequired = errors.New("sync token expired, full sync required")
+
+// SyncEvents lists the events on a calendar for incremental sync. Without a
+// syncToken it lists every event between timeMin and timeMax; with one only the
+// events changed since, whatever their time, cancelled ones included. It returns
+// the token for the next call, which is empty if Google didn't send one.
+// Recurring events are expanded into single instances.
+func SyncEvents(ctx context.Context, log *slog.Logger, svc *calendar.Service, calID, syncToken, timeMin, timeMax string) ([]*calendar.Event, string, error) {
+	call := svc.Events.List(calID).SingleEvents(true)
+	if syncToken != "" {
+		// Google refuses the time range along with a sync token, it sticks to the first one.
+		call = call.SyncToken(syncToken)
+	} else {
+		call = call.TimeMin(timeMin).TimeMax(timeMax)
+	}
+	var events []*calendar.Event
+	var next string
+	err := call.Pages(ctx, func(page *calendar.Events) error {
+		events = append(events, page.Items...)
+		next = page.NextSyncToken
+		return nil
+	})
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusGone {
+		return nil, "", fmt.Errorf("%w: %w", ErrFullSyncRequired, err)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	logutil.Or(log).Debug("synced events", "calendar", calID, "incremental", syncToken != "", "count", len(events))
+	return events, next, nil
+}
+
+// Retryable is the retry.Classifier for Calendar API calls: server errors, rate
+// limits (429, or 403 with a rate limit reason) and network timeouts are worth
+// another try, after the Retry-After Google sent if any.
+func Retryable(err error) (bool, time.Duration) {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		after := retry.ParseRetryAfter(apiErr.Header.Get("Retry-After"), time.Now())
+		if retry.Status(apiErr.Code) {
+			return true, after
+		}
+		if apiErr.Code == http.StatusForbidden {
+			for _, e := range apiErr.Errors {
+				if e.Reason == "rateLimitExceeded" || e.Reason == "userRateLimitExceeded" {
+					return true, after
+				}
+			}
+		}
+		return false, 0
 	}
-	return svc.Freebusy.Query(req).Do()
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout(), 0
 }
@@ -4,6 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
@@ -11,6 +15,7 @@ import (
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
@@ -63,7 +68,7 @@ func TestQueryFreeBusy_Valid(t *testing.T) {
 	calID := "primary"
 	now := time.Now().UTC()
 	to := now.Add(24 * time.Hour)
-	resp, err := QueryFreeBusy(context.Background(), svc, calID, now.Format(time.RFC3339), to.Format(time.RFC3339))
+	resp, err := QueryFreeBusy(context.Background(), svc, []string{calID}, now.Format(time.RFC3339), to.Format(time.RFC3339))
 	if err != nil {
 		t.Fatalf("QueryFreeBusy failed: %v", err)
 	}
@@ -76,7 +81,7 @@ func TestQueryFreeBusy_InvalidCalendarID(t *testing.T) {
 	svc := getTestService(t)
 	now := time.Now().UTC()
 	to := now.Add(24 * time.Hour)
-	resp, err := QueryFreeBusy(context.Background(), svc, "invalid_calendar_id", now.Format(time.RFC3339), to.Format(time.RFC3339))
+	resp, err := QueryFreeBusy(context.Background(), svc, []string{"invalid_calendar_id"}, now.Format(time.RFC3339), to.Format(time.RFC3339))
 	if err != nil {
 		t.Fatalf("unexpected error for invalid calendar ID: %v", err)
 	}
@@ -96,8 +101,123 @@ func TestQueryFreeBusy_InvalidTimeRange(t *testing.T) {
 	svc := getTestService(t)
 	calID := "primary"
 	// Invalid time format
-	_, err := QueryFreeBusy(context.Background(), svc, calID, "not-a-time", "not-a-time")
+	_, err := QueryFreeBusy(context.Background(), svc, []string{calID}, "not-a-time", "not-a-time")
 	if err == nil {
 		t.Error("expected error for invalid time range, got nil")
 	}
 }
+
+func TestAccepted(t *testing.T) {
+	timed := func(attendees ...*calendar.EventAttendee) *calendar.Event {
+		return &calendar.Event{
+			Start:     &calendar.EventDateTime{DateTime: "2025-08-20T10:00:00Z"},
+			End:       &calendar.EventDateTime{DateTime: "2025-08-20T11:00:00Z"},
+			Attendees: attendees,
+		}
+	}
+	tests := []struct {
+		name string
+		ev   *calendar.Event
+		want bool
+	}{
+		{"own event", timed(), true},
+		{"accepted", timed(&calendar.EventAttendee{Self: true, ResponseStatus: "accepted"}), true},
+		{"tentative", timed(&calendar.EventAttendee{Self: true, ResponseStatus: "tentative"}), false},
+		{"needs action", timed(&calendar.EventAttendee{Self: true, ResponseStatus: "needsAction"}), false},
+		{"not invited", timed(&calendar.EventAttendee{Email: "someone@example.com", ResponseStatus: "accepted"}), false},
+		{"cancelled", &calendar.Event{Status: "cancelled", Start: timed().Start, End: timed().End}, false},
+		{"transparent", &calendar.Event{Transparency: "transparent", Start: timed().Start, End: timed().End}, false},
+		{"all day", &calendar.Event{Start: &calendar.EventDateTime{Date: "2025-08-20"}, End: &calendar.EventDateTime{Date: "2025-08-21"}}, false},
+	}
+	for _, tt := range tests {
+		if got := Accepted(tt.ev); got != tt.want {
+			t.Errorf("%s: Accepted() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// fakeEvents serves events.list like Google for SyncEvents: a full list in two
+// pages ending with sync token "t1", the changes since "t1", and 410 Gone for
+// any other token.
+func fakeEvents(t *testing.T) *calendar.Service {
+	t.Helper()
+	event := func(id, status string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "status": status}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var body map[string]interface{}
+		switch {
+		case q.Get("syncToken") == "" && q.Get("pageToken") == "":
+			if q.Get("timeMin") == "" || q.Get("timeMax") == "" {
+				t.Errorf("full sync without a time range: %s", r.URL)
+			}
+			body = map[string]interface{}{"items": []interface{}{event("a", "confirmed")}, "nextPageToken": "p2"}
+		case q.Get("pageToken") == "p2":
+			body = map[string]interface{}{"items": []interface{}{event("b", "confirmed")}, "nextSyncToken": "t1"}
+		case q.Get("syncToken") == "t1":
+			if q.Get("timeMin") != "" {
+				t.Errorf("incremental sync with a time range: %s", r.URL)
+			}
+			body = map[string]interface{}{"items": []interface{}{event("b", "cancelled")}, "nextSyncToken": "t2"}
+		default:
+			w.WriteHeader(http.StatusGone)
+			body = map[string]interface{}{"error": map[string]interface{}{"code": 410, "message": "Sync token is no longer valid"}}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(srv.Close)
+	svc, err := calendar.NewService(context.Background(), option.WithEndpoint(srv.URL+"/"), option.WithHTTPClient(srv.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func TestSyncEvents(t *testing.T) {
+	svc := fakeEvents(t)
+	ctx := context.Background()
+
+	events, token, err := SyncEvents(ctx, nil, svc, "primary", "", "2026-10-19T00:00:00Z", "2026-10-26T00:00:00Z")
+	if err != nil {
+		t.Fatalf("full sync: %v", err)
+	}
+	if len(events) != 2 || token != "t1" {
+		t.Errorf("full sync: got %d events and token %q, want 2 and t1", len(events), token)
+	}
+
+	events, token, err = SyncEvents(ctx, nil, svc, "primary", "t1", "", "")
+	if err != nil {
+		t.Fatalf("incremental sync: %v", err)
+	}
+	if len(events) != 1 || events[0].Status != "cancelled" || token != "t2" {
+		t.Errorf("incremental sync: got %d events and token %q, want the cancelled one and t2", len(events), token)
+	}
+
+	if _, _, err := SyncEvents(ctx, nil, svc, "primary", "expired", "", ""); !errors.Is(err, ErrFullSyncRequired) {
+		t.Errorf("expired token: got %v, want ErrFullSyncRequired", err)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		retry bool
+		after time.Duration
+	}{
+		{"server error", &googleapi.Error{Code: 503}, true, 0},
+		{"too many requests", &googleapi.Error{Code: 429, Header: http.Header{"Retry-After": {"7"}}}, true, 7 * time.Second},
+		{"rate limited", &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}, true, 0},
+		{"forbidden", &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "forbidden"}}}, false, 0},
+		{"not found", fmt.Errorf("list: %w", &googleapi.Error{Code: 404}), false, 0},
+		{"other", errors.New("boom"), false, 0},
+	}
+	for _, tt := range tests {
+		retry, after := Retryable(tt.err)
+		if retry != tt.retry || after != tt.after {
+			t.Errorf("%s: got %v, %v, want %v, %v", tt.name, retry, after, tt.retry, tt.after)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"on-air/configutil"
+)
+
+// configCommand runs the "config" subcommands.
+func configCommand(args []string) {
+	if len(args) > 0 && args[0] == "migrate" {
+		configMigrate(args[1:])
+		return
+	}
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "usage: on-air config check|migrate [-config path]")
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("config check", flag.ExitOnError)
+	configPath := configFlag(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		log.Fatal(err)
+	}
+
+	if !checkConfig(*configPath, os.Environ(), os.Stderr) {
+		os.Exit(1)
+	}
+	fmt.Printf("%s is valid\n", *configPath)
+}
+
+// checkConfig loads and validates the config at path, writing all its problems to w.
+// It returns whether the config is valid.
+func checkConfig(path string, environ []string, w io.Writer) bool {
+	err := configutil.Check(path, environ)
+	if err == nil {
+		return true
+	}
+	var problems configutil.ValidationError
+	if !errors.As(err, &problems) {
+		fmt.Fprintf(w, "%s: %v\n", path, err)
+		return false
+	}
+	for _, p := range problems {
+		fmt.Fprintf(w, "%s: %s\n", path, p)
+	}
+	// The problems are found after migrating, so their paths are in the current
+	// layout rather than the file's.
+	if v, err := configutil.FileVersion(path); err == nil && v < configutil.CurrentVersion {
+		fmt.Fprintf(w, "%s is version %d, the paths above are in the version %d layout, run `on-air config migrate` to upgrade it\n", path, v, configutil.CurrentVersion)
+	}
+	return false
+}
+
+// configMigrate upgrades the config file to the current version, keeping a backup.
+func configMigrate(args []string) {
+	fs := flag.NewFlagSet("config migrate", flag.ExitOnError)
+	configPath := configFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+
+	from, backup, err := configutil.MigrateFile(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *configPath, err)
+		os.Exit(1)
+	}
+	if backup == "" {
+		fmt.Printf("%s is already version %d\n", *configPath, from)
+		return
+	}
+	fmt.Printf("Upgraded %s from version %d to %d, the original is in %s\n", *configPath, from, configutil.CurrentVersion, backup)
+}
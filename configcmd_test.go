@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckConfig_OlderVersion(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	v1 := `{"credentials": "` + filepath.Join(dir, "missing.json") + `", "calendar": "primary", "lifx_token": "t", "lifx_busy_color": "not a color"}`
+	if err := os.WriteFile(path, []byte(v1), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if checkConfig(path, nil, &out) {
+		t.Fatal("expected the config to be invalid")
+	}
+	if !strings.Contains(out.String(), "sinks[0].colors.busy") || !strings.Contains(out.String(), "on-air config migrate") {
+		t.Errorf("got %q, want the migrated paths and a pointer to config migrate", out.String())
+	}
+
+	// A current config's paths are its own.
+	v2 := `{"version": 2, "sources": [{"credentials": "` + filepath.Join(dir, "missing.json") + `", "calendars": [{"id": "primary"}]}]}`
+	if err := os.WriteFile(path, []byte(v2), 0600); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if checkConfig(path, nil, &out) {
+		t.Fatal("expected the config to be invalid")
+	}
+	if strings.Contains(out.String(), "config migrate") {
+		t.Errorf("got %q, want no pointer to config migrate", out.String())
+	}
+}
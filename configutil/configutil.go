@@ -2,39 +2,442 @@
 package configutil
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"go.yaml.in/yaml/v3"
+
+	"on-air/secrets"
 )
 
+// Config is the version 2 config: calendar sources, the lights (sinks) showing the
+// state, and the rules combining them. Older configs are migrated on load, see Migrate.
 type Config struct {
-	CredsPath             string `json:"credentials"`
-	TokenPath             string `json:"token"`
-	CalID                 string `json:"calendar"`
-	Days                  int    `json:"days"`
-	LifxToken             string `json:"lifx_token"`
-	LifxLightID           string `json:"lifx_light_id"`
-	LifxLightLabel        string `json:"lifx_light_label"`
-	LifxBusyColor         string `json:"lifx_busy_color"`
-	LifxFreeColor         string `json:"lifx_free_color"`
-	ReloadIntervalSeconds int    `json:"reload_interval_seconds"`
-}
-
-// LoadConfig loads config from the given file path.
+	Version       int            `json:"version"`
+	Sources       []SourceConfig `json:"sources,omitempty"`
+	Sinks         []SinkConfig   `json:"sinks,omitempty"`
+	Rules         RulesConfig    `json:"rules"`
+	StatusAddr    string         `json:"status_addr,omitempty"`
+	SecretStore   string         `json:"secret_store,omitempty"`    // "file" (default) or "sealed"
+	SecretKeyFile string         `json:"secret_key_file,omitempty"` // key for sealed secrets, else $ONAIR_SECRET_KEY
+	StateFile     string         `json:"state_file,omitempty"`      // where the last schedule and light state are kept between runs
+	WatchURL      string         `json:"watch_url,omitempty"`       // public HTTPS URL Google push notifications are sent to
+
+	store secrets.Store // opened by Load, see Secrets
+}
+
+// SourceConfig is a set of calendars read with one identity, e.g. a person in
+// shared-room mode. With auth set to "service_account" the key is used instead of
+// the OAuth client and token, impersonating subject if set.
+type SourceConfig struct {
+	Name              string           `json:"name,omitempty"`
+	AuthMode          string           `json:"auth,omitempty"`
+	CredsPath         string           `json:"credentials,omitempty"`
+	TokenPath         string           `json:"token,omitempty"`
+	ServiceAccountKey string           `json:"service_account_key,omitempty"`
+	Subject           string           `json:"subject,omitempty"`
+	Calendars         []CalendarConfig `json:"calendars,omitempty"`
+}
+
+// CalendarConfig is one calendar of a source.
+type CalendarConfig struct {
+	ID          string `json:"id"`
+	Role        string `json:"role,omitempty"`         // "busy" (default), "accepted" or "team"
+	IgnoreFrom  string `json:"ignore_from,omitempty"`  // "HH:MM" local time the calendar stops counting
+	IgnoreUntil string `json:"ignore_until,omitempty"` // "HH:MM" local time it counts again
+}
+
+// SinkConfig is a light the state is shown on.
+type SinkConfig struct {
+	Type       string       `json:"type,omitempty"` // "lifx" (default)
+	Token      string       `json:"token,omitempty"`
+	LightID    string       `json:"light_id,omitempty"`
+	LightLabel string       `json:"light_label,omitempty"`
+	Colors     ColorsConfig `json:"colors"`
+}
+
+// ColorsConfig are the colors of a sink per state, empty for the default.
+type ColorsConfig struct {
+	Busy    string `json:"busy,omitempty"`
+	Free    string `json:"free,omitempty"`
+	Team    string `json:"team,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Unknown string `json:"unknown,omitempty"`
+}
+
+// RulesConfig decide how the calendars turn into a state.
+type RulesConfig struct {
+	Days                  int    `json:"days,omitempty"`
+	Occupancy             string `json:"occupancy,omitempty"` // "any" (default) or "scaled"
+	ReloadIntervalSeconds int    `json:"reload_interval_seconds,omitempty"`
+	// MaxReloadFailures is how many reloads in a row may fail before the last good
+	// schedule is dropped and the lights show the unknown color.
+	MaxReloadFailures int `json:"max_reload_failures,omitempty"`
+	// StaleAfterSeconds is how old the last calendar sync or successful light
+	// command may get before the health check reports degraded.
+	StaleAfterSeconds int `json:"stale_after_seconds,omitempty"`
+}
+
+// LoadConfig loads config from the given file path. Unknown keys are rejected,
+// but the values aren't checked until Validate is called.
 func LoadConfig(path string) (*Config, error) {
-	f, err := os.Open(path)
+	return Load(path, nil, nil)
+}
+
+// Load builds the config from, lowest to highest precedence: the file at path,
+// the ONAIR_* variables in environ (e.g. ONAIR_LIFX_TOKEN for lifx_token) and the
+// flags set on fs that are named after a setting. Secret references are resolved
+// last, so any layer can use them.
+func Load(path string, environ []string, fs *flag.FlagSet) (*Config, error) {
+	cfg, from, err := decodeFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if from < CurrentVersion {
+		slog.Warn("config is an older version, run \"on-air config migrate\" to upgrade it", "path", path, "version", from)
+	}
+	if err := cfg.applyEnv(environ); err != nil {
+		return nil, err
+	}
+	if fs != nil {
+		if err := cfg.applyFlags(fs); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.resolveSecrets(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Check loads the config at path like Load without flags, then validates it. Every
+// problem found along the way is returned in one ValidationError: unknown keys,
+// values of the wrong type, secrets that don't resolve and what Validate finds.
+// Errors that stop the file from being read at all are returned as they are.
+func Check(path string, environ []string) error {
+	cfg, _, err := decodeFile(path)
+	var problems ValidationError
+	if !collect(&problems, err) {
+		return err
+	}
+	if err := cfg.applyEnv(environ); !collect(&problems, err) {
+		return err
+	}
+	if err := cfg.resolveSecrets(); !collect(&problems, err) {
+		return err
+	}
+	if err := cfg.Validate(); !collect(&problems, err) {
+		return err
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// collect adds the problems in err to problems. It returns false if err is
+// something other than problems.
+func collect(problems *ValidationError, err error) bool {
+	var found ValidationError
+	if errors.As(err, &found) {
+		*problems = append(*problems, found...)
+		return true
+	}
+	return err == nil
+}
+
+// decodeFile decodes the config file, migrating it to the current version.
+// It also returns the version the file was written in. Unknown keys and values
+// of the wrong type are returned as a ValidationError, along with the config
+// decoded from the rest of the file.
+func decodeFile(path string) (*Config, int, error) {
+	raw, err := readRaw(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	from, err := Migrate(raw)
+	if err != nil {
+		return nil, 0, fmt.Errorf("migrate config: %w", err)
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, 0, fmt.Errorf("decode config: %w", err)
+	}
+
+	v := &validator{}
+	v.known("", raw, reflect.TypeOf(Config{}))
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			return nil, 0, fmt.Errorf("decode config: %w", err)
+		}
+		v.add(typeErr.Field, "is a %s, want %s", typeErr.Value, typeErr.Type)
+	}
+	if len(v.problems) > 0 {
+		return &cfg, from, v.problems
+	}
+	return &cfg, from, nil
+}
+
+// readRaw reads the config file into a generic map, picking JSON, YAML or TOML by
+// its extension. YAML and TOML are converted to JSON first, so every format uses the same keys.
+func readRaw(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("open config: %w", err)
 	}
-	defer func(f *os.File) {
-		err = f.Close()
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, fmt.Errorf("decode config: %s is empty", path)
+	}
+
+	var raw map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		err = json.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decode config: %w", err)
+	}
+	// Round-trip through JSON so numbers and nested maps look the same whatever the format.
+	if data, err = json.Marshal(raw); err != nil {
+		return nil, fmt.Errorf("decode config: %w", err)
+	}
+	raw = nil
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("decode config: %w", err)
+	}
+	if raw == nil {
+		return nil, fmt.Errorf("decode config: %s is empty", path)
+	}
+	return raw, nil
+}
+
+// Save writes the config to path in the format picked by its extension. The file
+// is readable only by the owner since it may hold tokens.
+func (c *Config) Save(path string) error {
+	data, err := encode(c, filepath.Ext(path))
+	if err != nil {
+		return fmt.Errorf("encode config: %w", err)
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// envPrefix prefixes environment variables overriding settings.
+const envPrefix = "ONAIR_"
+
+// applyEnv sets the settings named by ONAIR_* variables in environ, returning the
+// variables that don't hold a valid value as a ValidationError.
+// Other ONAIR_* variables, like ONAIR_SECRET_KEY, are left alone.
+func (c *Config) applyEnv(environ []string) error {
+	v := &validator{}
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, envPrefix) {
+			continue
+		}
+		key := strings.ToLower(strings.TrimPrefix(name, envPrefix))
+		if !isSetting(key) {
+			continue
+		}
+		if err := c.Set(key, value); err != nil {
+			v.add(name, "%v", err)
+		}
+	}
+	if len(v.problems) > 0 {
+		return v.problems
+	}
+	return nil
+}
+
+// applyFlags sets the settings named by the flags that were set on fs.
+func (c *Config) applyFlags(fs *flag.FlagSet) error {
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if !isSetting(f.Name) || err != nil {
+			return
+		}
+		if serr := c.Set(f.Name, f.Value.String()); serr != nil {
+			err = fmt.Errorf("-%s: %w", f.Name, serr)
+		}
+	})
+	return err
+}
+
+// setters set the flat settings that flags and ONAIR_* variables are named after.
+// These are the version 1 keys; source and sink settings apply to the first of each.
+var setters = map[string]func(c *Config, value string) error{
+	"auth":                    text(func(c *Config) *string { return &c.source().AuthMode }),
+	"credentials":             text(func(c *Config) *string { return &c.source().CredsPath }),
+	"token":                   text(func(c *Config) *string { return &c.source().TokenPath }),
+	"service_account_key":     text(func(c *Config) *string { return &c.source().ServiceAccountKey }),
+	"subject":                 text(func(c *Config) *string { return &c.source().Subject }),
+	"calendar":                setCalendar,
+	"days":                    number(func(c *Config) *int { return &c.Rules.Days }),
+	"occupancy":               text(func(c *Config) *string { return &c.Rules.Occupancy }),
+	"reload_interval_seconds": number(func(c *Config) *int { return &c.Rules.ReloadIntervalSeconds }),
+	"stale_after_seconds":     number(func(c *Config) *int { return &c.Rules.StaleAfterSeconds }),
+	"max_reload_failures":     number(func(c *Config) *int { return &c.Rules.MaxReloadFailures }),
+	"lifx_token":              text(func(c *Config) *string { return &c.sink().Token }),
+	"lifx_light_id":           text(func(c *Config) *string { return &c.sink().LightID }),
+	"lifx_light_label":        text(func(c *Config) *string { return &c.sink().LightLabel }),
+	"lifx_busy_color":         text(func(c *Config) *string { return &c.sink().Colors.Busy }),
+	"lifx_free_color":         text(func(c *Config) *string { return &c.sink().Colors.Free }),
+	"lifx_team_color":         text(func(c *Config) *string { return &c.sink().Colors.Team }),
+	"lifx_error_color":        text(func(c *Config) *string { return &c.sink().Colors.Error }),
+	"lifx_unknown_color":      text(func(c *Config) *string { return &c.sink().Colors.Unknown }),
+	"status_addr":             text(func(c *Config) *string { return &c.StatusAddr }),
+	"secret_store":            text(func(c *Config) *string { return &c.SecretStore }),
+	"secret_key_file":         text(func(c *Config) *string { return &c.SecretKeyFile }),
+	"state_file":              text(func(c *Config) *string { return &c.StateFile }),
+	"watch_url":               text(func(c *Config) *string { return &c.WatchURL }),
+}
+
+// fileOnly are the settings that are lists or tables, so can only be set in the file.
+var fileOnly = map[string]bool{"calendars": true, "people": true, "sources": true, "sinks": true, "rules": true}
+
+func isSetting(key string) bool {
+	return setters[key] != nil || fileOnly[key]
+}
+
+func text(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func number(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
 		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		*field(c) = n
+		return nil
+	}
+}
 
+// setCalendar makes the first source watch a single calendar.
+func setCalendar(c *Config, value string) error {
+	c.source().Calendars = []CalendarConfig{{ID: value}}
+	return nil
+}
+
+// source returns the first source, adding one if there are none.
+func (c *Config) source() *SourceConfig {
+	if len(c.Sources) == 0 {
+		c.Sources = append(c.Sources, SourceConfig{})
+	}
+	return &c.Sources[0]
+}
+
+// sink returns the first sink, adding a LIFX one if there are none.
+func (c *Config) sink() *SinkConfig {
+	if len(c.Sinks) == 0 {
+		c.Sinks = append(c.Sinks, SinkConfig{Type: "lifx"})
+	}
+	return &c.Sinks[0]
+}
+
+// Set sets the flat setting with the given key from a string, as found in a flag
+// or environment variable. Lists like calendars can only be set in the file.
+func (c *Config) Set(key, value string) error {
+	if fileOnly[key] {
+		return fmt.Errorf("%s can only be set in the config file", key)
+	}
+	set, ok := setters[key]
+	if !ok {
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	if err := set(c, value); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+// Secrets returns the store that tokens and other secrets are kept in. A loaded
+// config returns the store Load opened.
+func (c *Config) Secrets() (secrets.Store, error) {
+	if c.store != nil {
+		return c.store, nil
+	}
+	switch c.SecretStore {
+	case "", "file":
+		return secrets.FileStore{}, nil
+	case "sealed":
+		key, err := secrets.LoadKey(c.SecretKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return secrets.SealedStore{Key: key}, nil
+	}
+	return nil, fmt.Errorf("unknown secret_store %q", c.SecretStore)
+}
+
+// resolveSecrets replaces env: and file: references in secret values with what
+// they point to. The ones that don't resolve are returned as a ValidationError.
+func (c *Config) resolveSecrets() error {
+	v := &validator{}
+	store, err := c.Secrets()
+	if err != nil {
+		v.add("secret_store", "%v", err)
+		return v.problems
+	}
+	c.store = store
+	for i := range c.Sinks {
+		token, err := secrets.Resolve(store, c.Sinks[i].Token)
+		if err != nil {
+			v.add(fmt.Sprintf("sinks[%d].token", i), "%v", err)
+			continue
+		}
+		c.Sinks[i].Token = token
+	}
+	if len(v.problems) > 0 {
+		return v.problems
+	}
+	return nil
+}
+
+// Watch polls the file at path every interval and sends on changed whenever its
+// size or modification time changes. It never returns, so run it in a goroutine.
+func Watch(path string, interval time.Duration, changed chan<- struct{}) {
+	stat := func() (time.Time, int64) {
+		info, err := os.Stat(path)
+		if err != nil {
+			// Editors may briefly remove the file while saving, it counts as a change once it's back.
+			return time.Time{}, -1
+		}
+		return info.ModTime(), info.Size()
+	}
+	lastMod, lastSize := stat()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		mod, size := stat()
+		if size < 0 || (mod.Equal(lastMod) && size == lastSize) {
+			continue
+		}
+		lastMod, lastSize = mod, size
+		select {
+		case changed <- struct{}{}:
+		default:
+			// A change is already pending
 		}
-	}(f)
-	var cfg Config
-	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
-		return nil, fmt.Errorf("decode config: %w", err)
 	}
-	return &cfg, nil
 }
@@ -1,8 +1,11 @@
 package configutil
 
 import (
+	"flag"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig_Valid(t *testing.T) {
@@ -28,35 +31,45 @@ func TestLoadConfig_Valid(t *testing.T) {
 	if err != nil {
 		t.Fatalf("LoadConfig failed: %v", err)
 	}
-	if cfg.CredsPath != "credentials.json" {
-		t.Errorf("CredsPath: got %v, want credentials.json", cfg.CredsPath)
+	if cfg.Version != CurrentVersion {
+		t.Errorf("Version: got %v, want %v", cfg.Version, CurrentVersion)
 	}
-	if cfg.TokenPath != "token.json" {
-		t.Errorf("TokenPath: got %v, want token.json", cfg.TokenPath)
+	if len(cfg.Sources) != 1 || len(cfg.Sinks) != 1 {
+		t.Fatalf("expected one source and one sink, got %+v", cfg)
 	}
-	if cfg.CalID != "primary" {
-		t.Errorf("CalID: got %v, want primary", cfg.CalID)
+	src, sink := cfg.Sources[0], cfg.Sinks[0]
+	if src.CredsPath != "credentials.json" {
+		t.Errorf("CredsPath: got %v, want credentials.json", src.CredsPath)
 	}
-	if cfg.Days != 7 {
-		t.Errorf("Days: got %v, want 7", cfg.Days)
+	if src.TokenPath != "token.json" {
+		t.Errorf("TokenPath: got %v, want token.json", src.TokenPath)
 	}
-	if cfg.LifxToken != "token" {
-		t.Errorf("LifxToken: got %v, want token", cfg.LifxToken)
+	if len(src.Calendars) != 1 || src.Calendars[0].ID != "primary" {
+		t.Errorf("Calendars: got %+v, want primary", src.Calendars)
 	}
-	if cfg.LifxLightID != "id" {
-		t.Errorf("LifxLightID: got %v, want id", cfg.LifxLightID)
+	if cfg.Rules.Days != 7 {
+		t.Errorf("Days: got %v, want 7", cfg.Rules.Days)
 	}
-	if cfg.LifxLightLabel != "label" {
-		t.Errorf("LifxLightLabel: got %v, want label", cfg.LifxLightLabel)
+	if sink.Type != "lifx" {
+		t.Errorf("Type: got %v, want lifx", sink.Type)
 	}
-	if cfg.LifxBusyColor != "red saturation:0.8" {
-		t.Errorf("LifxBusyColor: got %v, want red saturation:0.8", cfg.LifxBusyColor)
+	if sink.Token != "token" {
+		t.Errorf("Token: got %v, want token", sink.Token)
 	}
-	if cfg.LifxFreeColor != "kelvin:3500" {
-		t.Errorf("LifxFreeColor: got %v, want kelvin:3500", cfg.LifxFreeColor)
+	if sink.LightID != "id" {
+		t.Errorf("LightID: got %v, want id", sink.LightID)
 	}
-	if cfg.ReloadIntervalSeconds != 120 {
-		t.Errorf("ReloadIntervalSeconds: got %v, want 120", cfg.ReloadIntervalSeconds)
+	if sink.LightLabel != "label" {
+		t.Errorf("LightLabel: got %v, want label", sink.LightLabel)
+	}
+	if sink.Colors.Busy != "red saturation:0.8" {
+		t.Errorf("Colors.Busy: got %v, want red saturation:0.8", sink.Colors.Busy)
+	}
+	if sink.Colors.Free != "kelvin:3500" {
+		t.Errorf("Colors.Free: got %v, want kelvin:3500", sink.Colors.Free)
+	}
+	if cfg.Rules.ReloadIntervalSeconds != 120 {
+		t.Errorf("ReloadIntervalSeconds: got %v, want 120", cfg.Rules.ReloadIntervalSeconds)
 	}
 }
 
@@ -106,10 +119,330 @@ func TestLoadConfig_MissingFields(t *testing.T) {
 	if err != nil {
 		t.Fatalf("LoadConfig failed: %v", err)
 	}
-	if cfg.TokenPath != "" {
-		t.Errorf("TokenPath: got %v, want empty string", cfg.TokenPath)
+	if len(cfg.Sources) != 1 || cfg.Sources[0].TokenPath != "" {
+		t.Errorf("Sources: got %+v, want one without a token", cfg.Sources)
+	}
+	if len(cfg.Sinks) != 0 {
+		t.Errorf("Sinks: got %+v, want none", cfg.Sinks)
+	}
+	if cfg.Rules.Days != 0 {
+		t.Errorf("Days: got %v, want 0", cfg.Rules.Days)
+	}
+}
+
+func TestLoadConfig_Calendars(t *testing.T) {
+	file := "test_config_calendars.json"
+	content := `{
+		"calendars": [
+			{"id": "me@example.com"},
+			{"id": "team@example.com", "role": "team", "ignore_from": "18:00", "ignore_until": "09:00"}
+		]
+	}`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+	defer os.Remove(file)
+
+	cfg, err := LoadConfig(file)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.Sources) != 1 || len(cfg.Sources[0].Calendars) != 2 {
+		t.Fatalf("Calendars: got %+v, want one source with 2 calendars", cfg.Sources)
+	}
+	team := cfg.Sources[0].Calendars[1]
+	if team.ID != "team@example.com" || team.Role != "team" || team.IgnoreFrom != "18:00" || team.IgnoreUntil != "09:00" {
+		t.Errorf("Calendars[1]: got %+v", team)
+	}
+}
+
+func TestLoadConfig_People(t *testing.T) {
+	file := "test_config_people.json"
+	content := `{
+		"credentials": "credentials.json",
+		"occupancy": "scaled",
+		"people": [
+			{"name": "alice", "token": "alice_token.json"},
+			{"name": "bob", "token": "bob_token.json", "calendar": "bob@example.com"}
+		]
+	}`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+	defer os.Remove(file)
+
+	cfg, err := LoadConfig(file)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Rules.Occupancy != "scaled" {
+		t.Errorf("Occupancy: got %v, want scaled", cfg.Rules.Occupancy)
+	}
+	if len(cfg.Sources) != 2 {
+		t.Fatalf("Sources: got %d entries, want 2", len(cfg.Sources))
+	}
+	// People share the top-level OAuth client and default to their primary calendar
+	alice, bob := cfg.Sources[0], cfg.Sources[1]
+	if alice.Name != "alice" || alice.CredsPath != "credentials.json" || len(alice.Calendars) != 1 || alice.Calendars[0].ID != "primary" {
+		t.Errorf("Sources[0]: got %+v", alice)
+	}
+	if bob.Name != "bob" || bob.TokenPath != "bob_token.json" || len(bob.Calendars) != 1 || bob.Calendars[0].ID != "bob@example.com" {
+		t.Errorf("Sources[1]: got %+v", bob)
+	}
+}
+
+func TestLoadConfig_ServiceAccount(t *testing.T) {
+	file := "test_config_service_account.json"
+	content := `{
+		"auth": "service_account",
+		"service_account_key": "service-account.json",
+		"subject": "room@example.com"
+	}`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+	defer os.Remove(file)
+
+	cfg, err := LoadConfig(file)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.Sources) != 1 {
+		t.Fatalf("Sources: got %+v, want one", cfg.Sources)
+	}
+	src := cfg.Sources[0]
+	if src.AuthMode != "service_account" || src.ServiceAccountKey != "service-account.json" || src.Subject != "room@example.com" {
+		t.Errorf("service account fields: got %q %q %q", src.AuthMode, src.ServiceAccountKey, src.Subject)
+	}
+}
+
+func TestLoadConfig_SecretReferences(t *testing.T) {
+	t.Setenv("ONAIR_TEST_LIFX_TOKEN", "from-env")
+	file := "test_config_secrets.json"
+	content := `{"lifx_token": "env:ONAIR_TEST_LIFX_TOKEN"}`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+	defer os.Remove(file)
+
+	cfg, err := LoadConfig(file)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.Sinks) != 1 || cfg.Sinks[0].Token != "from-env" {
+		t.Errorf("Sinks: got %+v, want token from-env", cfg.Sinks)
+	}
+}
+
+func TestLoadConfig_SealedStoreWithoutKey(t *testing.T) {
+	t.Setenv("ONAIR_SECRET_KEY", "")
+	file := "test_config_sealed.json"
+	content := `{"secret_store": "sealed", "lifx_token": "token"}`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+	defer os.Remove(file)
+
+	if _, err := LoadConfig(file); err == nil {
+		t.Error("expected error for sealed store without a key, got nil")
+	}
+}
+
+func TestLoadConfig_UnknownField(t *testing.T) {
+	file := "test_config_unknown_field.json"
+	content := `{"credentials": "credentials.json", "lifx_tokn": "typo"}`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+	defer os.Remove(file)
+
+	_, err := LoadConfig(file)
+	if got := problemPaths(t, err); len(got) != 1 || got[0] != "lifx_tokn" {
+		t.Errorf("got %v, want the unknown key's path", got)
+	}
+}
+
+func TestLoadConfig_YAML(t *testing.T) {
+	file := "test_config.yaml"
+	content := `
+credentials: credentials.json
+calendar: primary
+days: 7
+lifx_busy_color: red saturation:0.8
+calendars:
+  - id: team@example.com
+    role: team
+`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+	defer os.Remove(file)
+
+	cfg, err := LoadConfig(file)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.Sources) != 1 || len(cfg.Sinks) != 1 {
+		t.Fatalf("expected one source and one sink, got %+v", cfg)
+	}
+	if cfg.Sources[0].CredsPath != "credentials.json" || cfg.Rules.Days != 7 || cfg.Sinks[0].Colors.Busy != "red saturation:0.8" {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if cals := cfg.Sources[0].Calendars; len(cals) != 1 || cals[0].Role != "team" {
+		t.Errorf("Calendars: got %+v", cals)
+	}
+}
+
+func TestLoadConfig_TOML(t *testing.T) {
+	file := "test_config.toml"
+	content := `
+credentials = "credentials.json"
+days = 7
+lifx_free_color = "kelvin:3500"
+
+[[people]]
+name = "alice"
+token = "alice_token.json"
+`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+	defer os.Remove(file)
+
+	cfg, err := LoadConfig(file)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.Sources) != 1 || len(cfg.Sinks) != 1 {
+		t.Fatalf("expected one source and one sink, got %+v", cfg)
+	}
+	if cfg.Sources[0].CredsPath != "credentials.json" || cfg.Rules.Days != 7 || cfg.Sinks[0].Colors.Free != "kelvin:3500" {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if cfg.Sources[0].TokenPath != "alice_token.json" {
+		t.Errorf("Sources: got %+v", cfg.Sources)
+	}
+}
+
+func TestLoadConfig_YAMLUnknownField(t *testing.T) {
+	file := "test_config_unknown_field.yml"
+	if err := os.WriteFile(file, []byte("lifx_tokn: typo\n"), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+	defer os.Remove(file)
+
+	if _, err := LoadConfig(file); err == nil {
+		t.Error("expected error for unknown field, got nil")
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	file := "test_config_precedence.json"
+	content := `{
+		"calendar": "from-file",
+		"days": 7,
+		"lifx_busy_color": "from-file",
+		"lifx_free_color": "from-file"
+	}`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+	defer os.Remove(file)
+
+	environ := []string{
+		"ONAIR_LIFX_BUSY_COLOR=from-env",
+		"ONAIR_LIFX_FREE_COLOR=from-env",
+		"ONAIR_DAYS=3",
+		"ONAIR_SECRET_KEY=not-a-setting",
+		"PATH=/usr/bin",
+	}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("config", "", "")
+	fs.String("lifx_free_color", "", "")
+	fs.String("lifx_light_id", "", "")
+	if err := fs.Parse([]string{"-lifx_free_color=from-flag", "-config=" + file}); err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	cfg, err := Load(file, environ, fs)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	// file < env < flags, and unset flags don't override anything
+	if cal := cfg.Sources[0].Calendars[0].ID; cal != "from-file" {
+		t.Errorf("calendar: got %v, want from-file", cal)
+	}
+	if cfg.Sinks[0].Colors.Busy != "from-env" {
+		t.Errorf("Colors.Busy: got %v, want from-env", cfg.Sinks[0].Colors.Busy)
+	}
+	if cfg.Sinks[0].Colors.Free != "from-flag" {
+		t.Errorf("Colors.Free: got %v, want from-flag", cfg.Sinks[0].Colors.Free)
+	}
+	if cfg.Rules.Days != 3 {
+		t.Errorf("Days: got %v, want 3", cfg.Rules.Days)
+	}
+}
+
+func TestLoad_BadEnvValue(t *testing.T) {
+	file := "test_config_bad_env.json"
+	if err := os.WriteFile(file, []byte(`{"days": 7}`), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+	defer os.Remove(file)
+
+	if _, err := Load(file, []string{"ONAIR_DAYS=seven"}, nil); err == nil {
+		t.Error("expected error for non-numeric ONAIR_DAYS, got nil")
+	}
+	if _, err := Load(file, []string{"ONAIR_CALENDARS=primary"}, nil); err == nil {
+		t.Error("expected error setting a list from the environment, got nil")
+	}
+}
+
+func TestSave(t *testing.T) {
+	cfg := &Config{
+		Version: CurrentVersion,
+		Sources: []SourceConfig{{CredsPath: "credentials.json", Calendars: []CalendarConfig{{ID: "primary"}}}},
+		Sinks:   []SinkConfig{{Type: "lifx", Token: "token", Colors: ColorsConfig{Busy: "red"}}},
+		Rules:   RulesConfig{Days: 7},
+	}
+	for _, ext := range []string{".json", ".yaml", ".toml"} {
+		file := filepath.Join(t.TempDir(), "config"+ext)
+		if err := cfg.Save(file); err != nil {
+			t.Fatalf("%s: Save failed: %v", ext, err)
+		}
+		if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("%s: expected a 0600 file, got %v, %v", ext, info, err)
+		}
+		got, err := LoadConfig(file)
+		if err != nil {
+			t.Fatalf("%s: LoadConfig failed: %v", ext, err)
+		}
+		if got.Rules.Days != 7 || got.Sinks[0].Colors.Busy != "red" || got.Sources[0].Calendars[0].ID != "primary" {
+			t.Errorf("%s: round trip: got %+v", ext, got)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(file, []byte(`{"days": 7}`), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+	changed := make(chan struct{}, 1)
+	go Watch(file, 10*time.Millisecond, changed)
+
+	select {
+	case <-changed:
+		t.Fatal("change reported before the file was touched")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(file, []byte(`{"days": 14}`), 0644); err != nil {
+		t.Fatalf("failed to rewrite test config: %v", err)
 	}
-	if cfg.Days != 0 {
-		t.Errorf("Days: got %v, want 0", cfg.Days)
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("change not reported")
 	}
 }
@@ -0,0 +1,238 @@
+package configutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"go.yaml.in/yaml/v3"
+)
+
+// CurrentVersion is the config version this build reads and writes.
+const CurrentVersion = 2
+
+// migrations upgrade a raw config from the version they're keyed by to the next one.
+var migrations = map[int]func(raw map[string]interface{}) error{
+	1: migrateV1,
+}
+
+// Migrate upgrades a raw config, as decoded from any format, to CurrentVersion in
+// place and returns the version it was written in. Configs without a version are version 1.
+func Migrate(raw map[string]interface{}) (int, error) {
+	from, err := version(raw)
+	if err != nil {
+		return 0, err
+	}
+	if from > CurrentVersion {
+		return 0, fmt.Errorf("version %d is newer than this on-air supports (%d)", from, CurrentVersion)
+	}
+	for v := from; v < CurrentVersion; v++ {
+		if err := migrations[v](raw); err != nil {
+			return 0, fmt.Errorf("version %d to %d: %w", v, v+1, err)
+		}
+		raw["version"] = v + 1
+	}
+	return from, nil
+}
+
+// FileVersion returns the version the config file at path is written in.
+func FileVersion(path string) (int, error) {
+	raw, err := readRaw(path)
+	if err != nil {
+		return 0, err
+	}
+	return version(raw)
+}
+
+// version returns the version of a raw config.
+func version(raw map[string]interface{}) (int, error) {
+	v, ok := raw["version"]
+	if !ok {
+		return 1, nil
+	}
+	n, ok := v.(float64)
+	if !ok || n != float64(int(n)) || n < 1 {
+		return 0, fmt.Errorf("version: %v is not a config version", v)
+	}
+	return int(n), nil
+}
+
+// migrateV1 moves the flat version 1 keys into sources, sinks and rules.
+// The top-level OAuth client was shared by people, so it's copied into each source.
+func migrateV1(raw map[string]interface{}) error {
+	take := func(m map[string]interface{}, keys map[string]string) map[string]interface{} {
+		out := make(map[string]interface{})
+		for from, to := range keys {
+			if v, ok := m[from]; ok {
+				out[to] = v
+				delete(m, from)
+			}
+		}
+		return out
+	}
+
+	top := take(raw, map[string]string{
+		"auth": "auth", "credentials": "credentials", "token": "token",
+		"service_account_key": "service_account_key", "subject": "subject",
+		"calendar": "calendar", "calendars": "calendars",
+	})
+	var sources []interface{}
+	if people, ok := raw["people"].([]interface{}); ok && len(people) > 0 {
+		for i, p := range people {
+			person, ok := p.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("people[%d] is not a table", i)
+			}
+			if _, ok := person["credentials"]; !ok && top["credentials"] != nil {
+				person["credentials"] = top["credentials"]
+			}
+			// People watched their primary calendar by default.
+			if _, ok := person["calendar"]; !ok {
+				person["calendar"] = "primary"
+			}
+			sources = append(sources, singleCalendar(person))
+		}
+	} else if len(top) > 0 {
+		sources = append(sources, singleCalendar(top))
+	}
+	delete(raw, "people")
+	if err := put(raw, "sources", sources); err != nil {
+		return err
+	}
+
+	sink := take(raw, map[string]string{
+		"lifx_token": "token", "lifx_light_id": "light_id", "lifx_light_label": "light_label",
+	})
+	colors := take(raw, map[string]string{
+		"lifx_busy_color": "busy", "lifx_free_color": "free", "lifx_team_color": "team", "lifx_error_color": "error",
+		"lifx_unknown_color": "unknown",
+	})
+	if len(colors) > 0 {
+		sink["colors"] = colors
+	}
+	if len(sink) > 0 {
+		sink["type"] = "lifx"
+		if err := put(raw, "sinks", []interface{}{sink}); err != nil {
+			return err
+		}
+	}
+
+	rules := take(raw, map[string]string{
+		"days": "days", "occupancy": "occupancy", "reload_interval_seconds": "reload_interval_seconds",
+		"max_reload_failures": "max_reload_failures", "stale_after_seconds": "stale_after_seconds",
+	})
+	if len(rules) > 0 {
+		if err := put(raw, "rules", rules); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// singleCalendar turns the calendar ID of a version 1 source into its calendars
+// list, which took precedence when both were set.
+func singleCalendar(src map[string]interface{}) map[string]interface{} {
+	id, ok := src["calendar"]
+	delete(src, "calendar")
+	if cals, _ := src["calendars"].([]interface{}); len(cals) == 0 && ok {
+		src["calendars"] = []interface{}{map[string]interface{}{"id": id}}
+	}
+	return src
+}
+
+// put sets a migrated key, refusing to overwrite one that was already there.
+func put(raw map[string]interface{}, key string, value interface{}) error {
+	if list, ok := value.([]interface{}); ok && len(list) == 0 {
+		return nil
+	}
+	if _, ok := raw[key]; ok {
+		return fmt.Errorf("%s can't be mixed with version 1 keys", key)
+	}
+	raw[key] = value
+	return nil
+}
+
+// MigrateFile upgrades the config file at path to CurrentVersion in its own format,
+// keeping the original next to it with a ".v<version>.bak" suffix. It returns the
+// version the file was in and the backup path, which is empty when it was already current.
+func MigrateFile(path string) (int, string, error) {
+	cfg, from, err := decodeFile(path)
+	if err != nil {
+		return 0, "", err
+	}
+	if from == CurrentVersion {
+		return from, "", nil
+	}
+
+	data, err := encode(cfg, filepath.Ext(path))
+	if err != nil {
+		return 0, "", fmt.Errorf("encode config: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, "", err
+	}
+	orig, err := os.ReadFile(path)
+	if err != nil {
+		return 0, "", err
+	}
+	backup := fmt.Sprintf("%s.v%d.bak", path, from)
+	if err := os.WriteFile(backup, orig, info.Mode().Perm()); err != nil {
+		return 0, "", fmt.Errorf("write backup: %w", err)
+	}
+	if err := os.WriteFile(path, data, info.Mode().Perm()); err != nil {
+		return 0, "", err
+	}
+	return from, backup, nil
+}
+
+// encode writes the config in the format of the given file extension.
+func encode(cfg *Config, ext string) ([]byte, error) {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml", ".toml":
+	default:
+		return append(data, '\n'), nil
+	}
+
+	// Go through a map so YAML and TOML use the JSON keys.
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	integers(raw)
+	if strings.ToLower(ext) == ".toml" {
+		var buf strings.Builder
+		if err := toml.NewEncoder(&buf).Encode(raw); err != nil {
+			return nil, err
+		}
+		return []byte(buf.String()), nil
+	}
+	return yaml.Marshal(raw)
+}
+
+// integers turns the whole float64 numbers JSON decodes into int64s, so they aren't
+// written as 7.0.
+func integers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case float64:
+		if v == float64(int64(v)) {
+			return int64(v)
+		}
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = integers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = integers(e)
+		}
+	}
+	return v
+}
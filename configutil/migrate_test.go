@@ -0,0 +1,116 @@
+package configutil
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrate_V1(t *testing.T) {
+	var raw map[string]interface{}
+	v1 := `{
+		"credentials": "credentials.json",
+		"occupancy": "scaled",
+		"days": 7,
+		"lifx_token": "token",
+		"lifx_light_id": "id",
+		"lifx_team_color": "blue",
+		"lifx_unknown_color": "purple",
+		"max_reload_failures": 5,
+		"stale_after_seconds": 900,
+		"people": [
+			{"name": "alice", "token": "alice.json"},
+			{"name": "room", "auth": "service_account", "service_account_key": "room.json", "calendars": [{"id": "room@example.com"}]}
+		],
+		"status_addr": "127.0.0.1:8080"
+	}`
+	if err := json.Unmarshal([]byte(v1), &raw); err != nil {
+		t.Fatal(err)
+	}
+	from, err := Migrate(raw)
+	if err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if from != 1 {
+		t.Errorf("from: got %d, want 1", from)
+	}
+
+	got, _ := json.Marshal(raw)
+	want := `{"rules":{"days":7,"max_reload_failures":5,"occupancy":"scaled","stale_after_seconds":900},` +
+		`"sinks":[{"colors":{"team":"blue","unknown":"purple"},"light_id":"id","token":"token","type":"lifx"}],` +
+		`"sources":[{"calendars":[{"id":"primary"}],"credentials":"credentials.json","name":"alice","token":"alice.json"},` +
+		`{"auth":"service_account","calendars":[{"id":"room@example.com"}],"credentials":"credentials.json","name":"room","service_account_key":"room.json"}],` +
+		`"status_addr":"127.0.0.1:8080","version":2}`
+	if string(got) != want {
+		t.Errorf("migrated:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestMigrate_Current(t *testing.T) {
+	raw := map[string]interface{}{"version": float64(2), "rules": map[string]interface{}{"days": float64(7)}}
+	if from, err := Migrate(raw); err != nil || from != 2 {
+		t.Errorf("Migrate: got %d, %v, want 2, nil", from, err)
+	}
+	if _, ok := raw["sources"]; ok {
+		t.Error("current config should be left alone")
+	}
+}
+
+func TestMigrate_Errors(t *testing.T) {
+	for name, raw := range map[string]map[string]interface{}{
+		"newer":   {"version": float64(CurrentVersion + 1)},
+		"bad":     {"version": "two"},
+		"mixed":   {"lifx_token": "token", "sinks": []interface{}{}},
+		"person":  {"people": []interface{}{"alice"}},
+		"version": {"version": float64(1.5)},
+	} {
+		if _, err := Migrate(raw); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
+
+func TestMigrateFile(t *testing.T) {
+	for _, ext := range []string{".json", ".yaml", ".toml"} {
+		dir := t.TempDir()
+		file := filepath.Join(dir, "config"+ext)
+		v1 := map[string]string{
+			".json": `{"calendar": "primary", "days": 7, "lifx_busy_color": "red", "lifx_unknown_color": "purple", "max_reload_failures": 5, "stale_after_seconds": 900}`,
+			".yaml": "calendar: primary\ndays: 7\nlifx_busy_color: red\nlifx_unknown_color: purple\nmax_reload_failures: 5\nstale_after_seconds: 900\n",
+			".toml": "calendar = \"primary\"\ndays = 7\nlifx_busy_color = \"red\"\nlifx_unknown_color = \"purple\"\nmax_reload_failures = 5\nstale_after_seconds = 900\n",
+		}[ext]
+		if err := os.WriteFile(file, []byte(v1), 0600); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+
+		from, backup, err := MigrateFile(file)
+		if err != nil {
+			t.Fatalf("%s: MigrateFile failed: %v", ext, err)
+		}
+		if from != 1 || backup != file+".v1.bak" {
+			t.Errorf("%s: got version %d, backup %q", ext, from, backup)
+		}
+		if orig, _ := os.ReadFile(backup); string(orig) != v1 {
+			t.Errorf("%s: backup: got %q, want the original", ext, orig)
+		}
+		if data, _ := os.ReadFile(file); strings.Contains(string(data), "7.0") {
+			t.Errorf("%s: days written as a float:\n%s", ext, data)
+		}
+
+		cfg, from, err := decodeFile(file)
+		if err != nil {
+			t.Fatalf("%s: decode migrated file: %v", ext, err)
+		}
+		if from != CurrentVersion || cfg.Rules.Days != 7 || cfg.Sinks[0].Colors.Busy != "red" || cfg.Sources[0].Calendars[0].ID != "primary" ||
+			cfg.Sinks[0].Colors.Unknown != "purple" || cfg.Rules.MaxReloadFailures != 5 || cfg.Rules.StaleAfterSeconds != 900 {
+			t.Errorf("%s: unexpected migrated config: %+v", ext, cfg)
+		}
+
+		// Migrating again is a no-op
+		if _, backup, err := MigrateFile(file); err != nil || backup != "" {
+			t.Errorf("%s: second migration: got backup %q, %v", ext, backup, err)
+		}
+	}
+}
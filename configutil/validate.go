@@ -0,0 +1,242 @@
+package configutil
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"on-air/lifxutil"
+)
+
+// Problem is something wrong with the config, at the JSON path of the offending value.
+type Problem struct {
+	Path string
+	Msg  string
+}
+
+func (p Problem) Error() string {
+	return p.Path + ": " + p.Msg
+}
+
+// ValidationError lists every problem found in a config.
+type ValidationError []Problem
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e))
+	for i, p := range e {
+		msgs[i] = p.Error()
+	}
+	return "invalid config:\n  " + strings.Join(msgs, "\n  ")
+}
+
+// validator collects problems as the config is walked.
+type validator struct {
+	problems ValidationError
+}
+
+func (v *validator) add(path, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Path: path, Msg: fmt.Sprintf(format, args...)})
+}
+
+// known reports the keys of raw that t has no field for, recursing into the
+// tables and lists whose fields are known.
+func (v *validator) known(path string, raw interface{}, t reflect.Type) {
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := raw.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			if name != "" && name != "-" {
+				fields[name] = t.Field(i).Type
+			}
+		}
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			p := key
+			if path != "" {
+				p = path + "." + key
+			}
+			ft, ok := fields[key]
+			if !ok {
+				v.add(p, "is not a known setting")
+				continue
+			}
+			v.known(p, m[key], ft)
+		}
+	case reflect.Slice:
+		list, ok := raw.([]interface{})
+		if !ok {
+			return
+		}
+		for i, e := range list {
+			v.known(fmt.Sprintf("%s[%d]", path, i), e, t.Elem())
+		}
+	}
+}
+
+func (v *validator) required(path, value string) bool {
+	if value == "" {
+		v.add(path, "is required")
+		return false
+	}
+	return true
+}
+
+func (v *validator) fileExists(path, file string) {
+	if !v.required(path, file) {
+		return
+	}
+	if _, err := os.Stat(file); err != nil {
+		v.add(path, "%v", err)
+	}
+}
+
+func (v *validator) oneOf(path, value string, allowed ...string) {
+	var names []string
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+		if a != "" {
+			names = append(names, a)
+		}
+	}
+	v.add(path, "%q is not one of %s", value, strings.Join(names, ", "))
+}
+
+func (v *validator) color(path, value string) {
+	if value == "" {
+		return
+	}
+	if err := lifxutil.ValidateColor(value); err != nil {
+		v.add(path, "%v", err)
+	}
+}
+
+func (v *validator) clock(path, value string) {
+	if _, err := time.Parse("15:04", value); err != nil {
+		v.add(path, "%q is not a HH:MM time", value)
+	}
+}
+
+// source checks the auth settings of a calendar source.
+func (v *validator) source(prefix string, s SourceConfig) {
+	v.oneOf(prefix+"auth", s.AuthMode, "", "oauth", "service_account")
+	if s.AuthMode == "service_account" {
+		v.fileExists(prefix+"service_account_key", s.ServiceAccountKey)
+		return
+	}
+	v.fileExists(prefix+"credentials", s.CredsPath)
+	v.required(prefix+"token", s.TokenPath)
+}
+
+// sink checks a light and its colors.
+func (v *validator) sink(prefix string, s SinkConfig) {
+	v.oneOf(prefix+"type", s.Type, "", "lifx")
+	v.required(prefix+"token", s.Token)
+	if v.required(prefix+"light_id", s.LightID) {
+		if err := lifxutil.ValidateLightID(s.LightID); err != nil {
+			v.add(prefix+"light_id", "%v", err)
+		}
+	}
+	v.color(prefix+"colors.busy", s.Colors.Busy)
+	v.color(prefix+"colors.free", s.Colors.Free)
+	v.color(prefix+"colors.team", s.Colors.Team)
+	v.color(prefix+"colors.error", s.Colors.Error)
+	v.color(prefix+"colors.unknown", s.Colors.Unknown)
+}
+
+func (v *validator) calendars(prefix string, cals []CalendarConfig) {
+	for i, c := range cals {
+		path := fmt.Sprintf("%scalendars[%d]", prefix, i)
+		v.required(path+".id", c.ID)
+		v.oneOf(path+".role", c.Role, "", "busy", "accepted", "team")
+		if (c.IgnoreFrom == "") != (c.IgnoreUntil == "") {
+			v.add(path, "ignore_from and ignore_until must be set together")
+			continue
+		}
+		if c.IgnoreFrom != "" {
+			v.clock(path+".ignore_from", c.IgnoreFrom)
+			v.clock(path+".ignore_until", c.IgnoreUntil)
+		}
+	}
+}
+
+// Validate checks the config and returns a ValidationError listing every problem, or nil.
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	if len(c.Sources) == 0 {
+		v.add("sources", "at least one source is required")
+	}
+	names := make(map[string]bool)
+	for i, s := range c.Sources {
+		prefix := fmt.Sprintf("sources[%d].", i)
+		// A single source doesn't need a name, several have to be told apart.
+		if len(c.Sources) > 1 && v.required(prefix+"name", s.Name) {
+			if names[s.Name] {
+				v.add(prefix+"name", "%q is used by more than one source", s.Name)
+			}
+			names[s.Name] = true
+		}
+		v.source(prefix, s)
+		if len(s.Calendars) == 0 {
+			v.add(prefix+"calendars", "at least one calendar is required")
+		}
+		v.calendars(prefix, s.Calendars)
+	}
+
+	if len(c.Sinks) == 0 {
+		v.add("sinks", "at least one light is required")
+	}
+	for i, s := range c.Sinks {
+		v.sink(fmt.Sprintf("sinks[%d].", i), s)
+	}
+
+	if c.Rules.Days < 1 {
+		v.add("rules.days", "must be at least 1, got %d", c.Rules.Days)
+	}
+	v.oneOf("rules.occupancy", c.Rules.Occupancy, "", "any", "scaled")
+	if c.Rules.ReloadIntervalSeconds < 0 {
+		v.add("rules.reload_interval_seconds", "must not be negative, got %d", c.Rules.ReloadIntervalSeconds)
+	}
+	if c.Rules.MaxReloadFailures < 0 {
+		v.add("rules.max_reload_failures", "must not be negative, got %d", c.Rules.MaxReloadFailures)
+	}
+	if c.Rules.StaleAfterSeconds < 0 {
+		v.add("rules.stale_after_seconds", "must not be negative, got %d", c.Rules.StaleAfterSeconds)
+	}
+
+	if c.StatusAddr != "" {
+		if _, _, err := net.SplitHostPort(c.StatusAddr); err != nil {
+			v.add("status_addr", "%v", err)
+		}
+	}
+	v.oneOf("secret_store", c.SecretStore, "", "file", "sealed")
+	if c.WatchURL != "" {
+		if u, err := url.Parse(c.WatchURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			v.add("watch_url", "%q is not an https URL", c.WatchURL)
+		}
+		if c.StatusAddr == "" {
+			v.add("watch_url", "needs status_addr, which the notifications are received on")
+		}
+	}
+
+	if len(v.problems) > 0 {
+		return v.problems
+	}
+	return nil
+}
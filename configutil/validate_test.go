@@ -0,0 +1,175 @@
+package configutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func validConfig(t *testing.T) *Config {
+	creds := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(creds, []byte("{}"), 0600); err != nil {
+		t.Fatalf("write credentials: %v", err)
+	}
+	return &Config{
+		Version: CurrentVersion,
+		Sources: []SourceConfig{{
+			CredsPath: creds,
+			TokenPath: "token.json",
+			Calendars: []CalendarConfig{{ID: "primary"}},
+		}},
+		Sinks: []SinkConfig{{
+			Type:    "lifx",
+			Token:   "token",
+			LightID: "d073d5000001",
+			Colors:  ColorsConfig{Busy: "red saturation:0.8", Free: "kelvin:3500"},
+		}},
+		Rules: RulesConfig{Days: 7},
+	}
+}
+
+func problemPaths(t *testing.T, err error) []string {
+	var problems ValidationError
+	if !errors.As(err, &problems) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	var paths []string
+	for _, p := range problems {
+		paths = append(paths, p.Path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestValidate_Valid(t *testing.T) {
+	if err := validConfig(t).Validate(); err != nil {
+		t.Errorf("Validate: unexpected error %v", err)
+	}
+}
+
+func TestValidate_CollectsEveryProblem(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.Sources[0].CredsPath = "missing_credentials.json"
+	cfg.Rules.Days = -1
+	cfg.Sinks[0].LightID = "id:d073d5000001"
+	cfg.Sinks[0].Colors.Busy = "redd"
+	cfg.Sources[0].Calendars = []CalendarConfig{
+		{ID: "team@example.com", Role: "teams", IgnoreFrom: "18:00"},
+	}
+
+	got := problemPaths(t, cfg.Validate())
+	want := []string{"rules.days", "sinks[0].colors.busy", "sinks[0].light_id", "sources[0].calendars[0]", "sources[0].calendars[0].role", "sources[0].credentials"}
+	if len(got) != len(want) {
+		t.Fatalf("problems: got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("problems: got %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestValidate_Empty(t *testing.T) {
+	got := problemPaths(t, (&Config{}).Validate())
+	for _, want := range []string{"sources", "sinks", "rules.days"} {
+		found := false
+		for _, p := range got {
+			if p == want {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected a problem at %s, got %v", want, got)
+		}
+	}
+}
+
+func TestValidate_Sources(t *testing.T) {
+	cfg := validConfig(t)
+	creds := cfg.Sources[0].CredsPath
+	cals := []CalendarConfig{{ID: "primary"}}
+	cfg.Sources = []SourceConfig{
+		{Name: "alice", CredsPath: creds, TokenPath: "alice.json", Calendars: cals},
+		{Name: "alice", CredsPath: creds, Calendars: cals},
+		{Name: "room", AuthMode: "service_account"},
+	}
+	got := problemPaths(t, cfg.Validate())
+	want := []string{"sources[1].name", "sources[1].token", "sources[2].calendars", "sources[2].service_account_key"}
+	if len(got) != len(want) {
+		t.Fatalf("problems: got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("problems: got %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestValidate_WatchURL(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.WatchURL = "http://onair.example.com/watch"
+	if got := problemPaths(t, cfg.Validate()); len(got) != 2 || got[0] != "watch_url" {
+		t.Errorf("plain http without status_addr: got %v, want two watch_url problems", got)
+	}
+
+	cfg.WatchURL = "https://onair.example.com/watch"
+	cfg.StatusAddr = "127.0.0.1:8080"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate: unexpected error %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	creds := filepath.Join(dir, "credentials.json")
+	if err := os.WriteFile(creds, []byte("{}"), 0600); err != nil {
+		t.Fatalf("write credentials: %v", err)
+	}
+	path := filepath.Join(dir, "config.json")
+	content := `{
+		"version": 2,
+		"sources": [{"credentials": "` + creds + `", "token": "token.json", "calendars": [{"id": "primary", "rol": "team"}]}],
+		"sinks": [{"token": "env:ONAIR_TEST_UNSET", "light_id": "d073d5000001", "colors": {"busy": "redd"}}],
+		"rules": {"days": -1},
+		"status_adr": "127.0.0.1:8080"
+	}`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	got := problemPaths(t, Check(path, []string{"ONAIR_RELOAD_INTERVAL_SECONDS=soon"}))
+	want := []string{
+		"ONAIR_RELOAD_INTERVAL_SECONDS",
+		"rules.days",
+		"sinks[0].colors.busy",
+		"sinks[0].token",
+		"sources[0].calendars[0].rol",
+		"status_adr",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if err := Check(filepath.Join(dir, "missing.json"), nil); err == nil || errors.As(err, new(ValidationError)) {
+		t.Errorf("missing file: got %v, want a plain error", err)
+	}
+}
+
+func TestCheck_WrongType(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"version": 2, "rules": {"days": "seven"}}`), 0600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	var problems ValidationError
+	if !errors.As(Check(path, nil), &problems) || problems[0].Path != "rules.days" {
+		t.Fatalf("got %v, want rules.days first", problems)
+	}
+	if want := "is a string, want int"; problems[0].Msg != want {
+		t.Errorf("got %q, want %q", problems[0].Msg, want)
+	}
+}
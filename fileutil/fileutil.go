@@ -0,0 +1,39 @@
+// Package fileutil holds file helpers shared by the packages that keep state on disk.
+package fileutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile atomically replaces path with data, readable only by us. The data
+// is written to a temporary file next to path, synced and renamed over path, so
+// a crash leaves either the old file or the new one, never half of one.
+func WriteFile(path string, data []byte) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, os.Remove(f.Name()))
+		}
+	}()
+	if err := f.Chmod(0600); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"on-air/auth"
+	"on-air/configutil"
+	"on-air/lifxutil"
+	"on-air/schedule"
+	"on-air/secrets"
+)
+
+// initCommand runs the setup wizard, which asks for everything a config needs,
+// logs in to Google, picks a light and writes a validated config.
+func initCommand(args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", "config.json", "path to write the config to (.json, .yaml or .toml)")
+		device     = fs.Bool("device", false, "use the device authorization flow for machines without a browser")
+		noBrowser  = fs.Bool("no-browser", false, "don't try to open a browser, just print the link")
+		force      = fs.Bool("force", false, "overwrite an existing config")
+	)
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := os.Stat(*configPath); err == nil && !*force {
+		log.Fatalf("%s already exists, pass -force to overwrite it", *configPath)
+	}
+
+	w := &wizard{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+	cfg, err := w.run(context.Background(), *device, *noBrowser)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Save(*configPath); err != nil {
+		log.Fatalf("failed to write config: %v", err)
+	}
+	fmt.Printf("\nWrote %s, start on-air with: on-air -config %s\n", *configPath, *configPath)
+}
+
+// wizard asks its questions on out and reads the answers from in.
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+	// lifx returns the client for a LIFX token, lifxutil.NewClient if nil.
+	lifx func(token string) *lifxutil.Client
+}
+
+func (w *wizard) client(token string) *lifxutil.Client {
+	if w.lifx != nil {
+		return w.lifx(token)
+	}
+	return lifxutil.NewClient(token)
+}
+
+// ask asks a question and returns the answer, or def when it's left empty.
+func (w *wizard) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", question)
+	}
+	line, err := w.in.ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		return "", fmt.Errorf("setup cancelled: %w", err)
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+// confirm asks a yes/no question, yes being the default.
+func (w *wizard) confirm(question string) (bool, error) {
+	answer, err := w.ask(question+" (y/n)", "y")
+	if err != nil {
+		return false, err
+	}
+	return strings.HasPrefix(strings.ToLower(answer), "y"), nil
+}
+
+func (w *wizard) run(ctx context.Context, device, noBrowser bool) (*configutil.Config, error) {
+	fmt.Fprintln(w.out, "Let's set up on-air. Press enter to take the default in brackets.")
+
+	fmt.Fprintln(w.out, "\nGoogle Calendar")
+	src, err := w.source(ctx, device, noBrowser)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintln(w.out, "\nLIFX")
+	sink, err := w.sink()
+	if err != nil {
+		return nil, err
+	}
+
+	days := 0
+	for days < 1 {
+		answer, err := w.ask("How many days ahead to check", "7")
+		if err != nil {
+			return nil, err
+		}
+		if days, err = strconv.Atoi(answer); err != nil || days < 1 {
+			fmt.Fprintln(w.out, "  Please enter a whole number of days, at least 1.")
+			days = 0
+		}
+	}
+
+	return &configutil.Config{
+		Version: configutil.CurrentVersion,
+		Sources: []configutil.SourceConfig{src},
+		Sinks:   []configutil.SinkConfig{sink},
+		Rules:   configutil.RulesConfig{Days: days},
+	}, nil
+}
+
+// source asks for the OAuth client and calendar, then logs in unless there's a token already.
+func (w *wizard) source(ctx context.Context, device, noBrowser bool) (configutil.SourceConfig, error) {
+	var src configutil.SourceConfig
+	var err error
+	for {
+		if src.CredsPath, err = w.ask("Path to the OAuth client JSON from the Google Cloud Console", "credentials.json"); err != nil {
+			return src, err
+		}
+		if _, err := os.Stat(src.CredsPath); err == nil {
+			break
+		}
+		fmt.Fprintf(w.out, "  Can't find %s, download it from APIs & Services > Credentials.\n", src.CredsPath)
+	}
+	if src.TokenPath, err = w.ask("Where to keep your Google token", "token.json"); err != nil {
+		return src, err
+	}
+	calID, err := w.ask("Calendar ID", "primary")
+	if err != nil {
+		return src, err
+	}
+	src.Calendars = []configutil.CalendarConfig{{ID: calID}}
+
+	if _, err := os.Stat(src.TokenPath); err == nil {
+		fmt.Fprintf(w.out, "  Using the existing token in %s.\n", src.TokenPath)
+		return src, nil
+	}
+	cals := []schedule.Calendar{{ID: calID, Role: schedule.RoleBusy}}
+	if err := auth.Login(ctx, secrets.FileStore{}, src.CredsPath, src.TokenPath, device, noBrowser, schedule.Scopes(cals)...); err != nil {
+		return src, fmt.Errorf("login failed: %w", err)
+	}
+	fmt.Fprintf(w.out, "  Saved token to %s.\n", src.TokenPath)
+	return src, nil
+}
+
+// sink asks for the LIFX token, lets the user pick one of their lights and tries
+// the colors out on it.
+func (w *wizard) sink() (configutil.SinkConfig, error) {
+	sink := configutil.SinkConfig{Type: "lifx"}
+	var lights []lifxutil.Light
+	var err error
+	for len(lights) == 0 {
+		if sink.Token, err = w.ask("LIFX API token, from https://cloud.lifx.com/settings", ""); err != nil {
+			return sink, err
+		}
+		if lights, err = w.client(sink.Token).ListLights(); err != nil {
+			fmt.Fprintf(w.out, "  Couldn't list your lights: %v\n", err)
+		} else if len(lights) == 0 {
+			fmt.Fprintln(w.out, "  There are no lights on this account.")
+		}
+	}
+
+	for i, l := range lights {
+		fmt.Fprintf(w.out, "  %d) %s (%s, %s)\n", i+1, l.Label, l.ID, l.Power)
+	}
+	var light lifxutil.Light
+	for light.ID == "" {
+		answer, err := w.ask("Which light", "1")
+		if err != nil {
+			return sink, err
+		}
+		n, err := strconv.Atoi(answer)
+		if err != nil || n < 1 || n > len(lights) {
+			fmt.Fprintf(w.out, "  Please pick a number from 1 to %d.\n", len(lights))
+			continue
+		}
+		light = lights[n-1]
+	}
+	sink.LightID, sink.LightLabel = light.ID, light.Label
+
+	lc := w.client(sink.Token)
+	if sink.Colors.Busy, err = w.color("Busy color", "red saturation:0.8", func(c string) error { return lc.SetBusy(light, c) }); err != nil {
+		return sink, err
+	}
+	if sink.Colors.Free, err = w.color("Free color", "kelvin:3500", func(c string) error { return lc.SetFree(light, c) }); err != nil {
+		return sink, err
+	}
+	return sink, nil
+}
+
+// color asks for a color and previews it on the light until the user is happy with it.
+func (w *wizard) color(question, def string, preview func(string) error) (string, error) {
+	for {
+		c, err := w.ask(question, def)
+		if err != nil {
+			return "", err
+		}
+		if err := lifxutil.ValidateColor(c); err != nil {
+			fmt.Fprintf(w.out, "  %v\n", err)
+			continue
+		}
+		if err := preview(c); err != nil {
+			fmt.Fprintf(w.out, "  Couldn't preview the color: %v\n", err)
+		}
+		ok, err := w.confirm("  The light should show it now, keep it?")
+		if err != nil || ok {
+			return c, err
+		}
+	}
+}
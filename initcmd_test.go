@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"on-air/lifxutil"
+)
+
+// fakeLIFX serves two lights and records the states set on them.
+type fakeLIFX struct {
+	mu     sync.Mutex
+	states []map[string]interface{}
+}
+
+func (f *fakeLIFX) server(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer lifx-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"Invalid token"}`))
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/lights/all":
+			_ = json.NewEncoder(w).Encode([]lifxutil.Light{
+				{ID: "d073d5000001", Label: "Desk", Power: "on"},
+				{ID: "d073d5000002", Label: "Door", Power: "off"},
+			})
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/lights/id:d073d5000002/state":
+			var state map[string]interface{}
+			_ = json.NewDecoder(r.Body).Decode(&state)
+			f.mu.Lock()
+			f.states = append(f.states, state)
+			f.mu.Unlock()
+			w.WriteHeader(http.StatusMultiStatus)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestWizard(t *testing.T) {
+	dir := t.TempDir()
+	creds := filepath.Join(dir, "credentials.json")
+	token := filepath.Join(dir, "token.json")
+	for _, path := range []string{creds, token} {
+		if err := os.WriteFile(path, []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f := &fakeLIFX{}
+	srv := f.server(t)
+
+	answers := []string{
+		filepath.Join(dir, "missing.json"), // not there, asked again
+		creds,
+		token, // already logged in
+		"",    // primary
+		"wrong-token",
+		"lifx-token",
+		"3", // out of range
+		"two",
+		"2",
+		"mauve", // not a color
+		"blue",
+		"n", // previewed, but not kept
+		"",  // red saturation:0.8
+		"y",
+		"", // kelvin:3500
+		"",
+		"0", // too few days
+		"",
+	}
+	var out strings.Builder
+	w := &wizard{
+		in:  bufio.NewReader(strings.NewReader(strings.Join(answers, "\n") + "\n")),
+		out: &out,
+		lifx: func(token string) *lifxutil.Client {
+			return &lifxutil.Client{Token: token, BaseURL: srv.URL + "/v1/"}
+		},
+	}
+	cfg, err := w.run(context.Background(), false, false)
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out.String())
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("written config doesn't validate: %v", err)
+	}
+
+	for _, want := range []string{
+		"Can't find " + filepath.Join(dir, "missing.json"),
+		"Using the existing token",
+		"Couldn't list your lights",
+		"2) Door (d073d5000002, off)",
+		`invalid color "mauve"`,
+		"Please enter a whole number of days",
+	} {
+		if strings.Count(out.String(), want) != 1 {
+			t.Errorf("output doesn't say %q once:\n%s", want, out.String())
+		}
+	}
+	if strings.Count(out.String(), "Please pick a number from 1 to 2.") != 2 {
+		t.Errorf("want both bad light numbers asked again:\n%s", out.String())
+	}
+
+	src, sink := cfg.Sources[0], cfg.Sinks[0]
+	if src.CredsPath != creds || src.TokenPath != token || src.Calendars[0].ID != "primary" {
+		t.Errorf("source: got %+v", src)
+	}
+	if sink.Token != "lifx-token" || sink.LightID != "d073d5000002" || sink.LightLabel != "Door" {
+		t.Errorf("sink: got %+v, want the Door light", sink)
+	}
+	if sink.Colors.Busy != "red saturation:0.8" || sink.Colors.Free != "kelvin:3500" {
+		t.Errorf("colors: got %+v, want the defaults", sink.Colors)
+	}
+	if cfg.Rules.Days != 7 {
+		t.Errorf("days: got %d, want 7", cfg.Rules.Days)
+	}
+
+	// Each color that passed validation was previewed on the chosen light.
+	var previewed []string
+	for _, s := range f.states {
+		previewed = append(previewed, s["color"].(string))
+	}
+	if got := strings.Join(previewed, ", "); got != "blue, red saturation:0.8, kelvin:3500" {
+		t.Errorf("previews: got %s, want blue, red saturation:0.8, kelvin:3500", got)
+	}
+}
+
+func TestWizard_Cancelled(t *testing.T) {
+	w := &wizard{in: bufio.NewReader(strings.NewReader("")), out: &strings.Builder{}}
+	if _, err := w.run(context.Background(), false, false); err == nil || !strings.Contains(err.Error(), "setup cancelled") {
+		t.Errorf("got %v, want setup cancelled at the end of the input", err)
+	}
+}
@@ -0,0 +1,86 @@
+package lifxutil
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// namedColors are the color names the LIFX API understands.
+var namedColors = map[string]bool{
+	"white": true, "red": true, "orange": true, "yellow": true, "cyan": true,
+	"green": true, "blue": true, "purple": true, "pink": true,
+}
+
+var hexColor = regexp.MustCompile(`^#?[0-9a-fA-F]{6}$`)
+
+// ValidateColor checks a color string such as "red saturation:0.8" or "kelvin:3500"
+// against the LIFX color format, so mistakes show up before a request is made.
+// See https://api.developer.lifx.com/docs/colors.
+func ValidateColor(s string) error {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return fmt.Errorf("empty color")
+	}
+	for _, f := range fields {
+		if err := validateColorPart(strings.ToLower(f)); err != nil {
+			return fmt.Errorf("invalid color %q: %w", s, err)
+		}
+	}
+	return nil
+}
+
+func validateColorPart(f string) error {
+	if namedColors[f] || hexColor.MatchString(f) {
+		return nil
+	}
+	name, value, ok := strings.Cut(f, ":")
+	if !ok {
+		return fmt.Errorf("unknown color %q", f)
+	}
+	switch name {
+	case "hue":
+		return inRange(name, value, 0, 360)
+	case "saturation", "brightness":
+		return inRange(name, value, 0, 1)
+	case "kelvin":
+		return inRange(name, value, 1500, 9000)
+	case "rgb":
+		parts := strings.Split(value, ",")
+		if len(parts) != 3 {
+			return fmt.Errorf("rgb needs three values")
+		}
+		for _, p := range parts {
+			if err := inRange(name, p, 0, 255); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown color component %q", name)
+}
+
+func inRange(name, value string, lo, hi float64) error {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("%s: %q is not a number", name, value)
+	}
+	if v < lo || v > hi {
+		return fmt.Errorf("%s: %v is outside %v-%v", name, v, lo, hi)
+	}
+	return nil
+}
+
+var lightID = regexp.MustCompile(`^[0-9a-zA-Z]+$`)
+
+// ValidateLightID checks a light ID can be used in an "id:" selector.
+func ValidateLightID(id string) error {
+	if strings.HasPrefix(id, "id:") {
+		return fmt.Errorf("%q: give the bare ID without the id: prefix", id)
+	}
+	if !lightID.MatchString(id) {
+		return fmt.Errorf("%q is not a valid light ID", id)
+	}
+	return nil
+}
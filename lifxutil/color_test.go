@@ -0,0 +1,46 @@
+package lifxutil
+
+import "testing"
+
+func TestValidateColor(t *testing.T) {
+	valid := []string{
+		"red",
+		"red saturation:0.8",
+		"kelvin:3500",
+		"kelvin:2671",
+		"#ff0000",
+		"hue:120 saturation:1.0 brightness:0.5",
+		"rgb:255,0,0",
+		"Blue",
+	}
+	for _, c := range valid {
+		if err := ValidateColor(c); err != nil {
+			t.Errorf("ValidateColor(%q): unexpected error %v", c, err)
+		}
+	}
+	invalid := []string{
+		"",
+		"redd",
+		"saturation:2",
+		"kelvin:100",
+		"hue:abc",
+		"rgb:1,2",
+		"tint:0.5",
+	}
+	for _, c := range invalid {
+		if err := ValidateColor(c); err == nil {
+			t.Errorf("ValidateColor(%q): expected error, got nil", c)
+		}
+	}
+}
+
+func TestValidateLightID(t *testing.T) {
+	if err := ValidateLightID("d073d5000001"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, id := range []string{"", "id:d073d5000001", "my light", "a/b"} {
+		if err := ValidateLightID(id); err == nil {
+			t.Errorf("ValidateLightID(%q): expected error, got nil", id)
+		}
+	}
+}
@@ -3,16 +3,66 @@ package lifxutil
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"on-air/logutil"
+	"on-air/metrics"
+	"on-air/retry"
 )
 
 // Client holds the Lifx API token.
 type Client struct {
 	Token   string
 	BaseURL string
+	// HTTP sends the requests, http.DefaultClient if nil.
+	HTTP *http.Client
+	// Log is where requests are logged, slog.Default() if nil.
+	Log *slog.Logger
+	// Retry is how failed requests are retried, DefaultRetry if nil.
+	Retry *retry.Policy
+	// Limit is the token's request budget. Requests wait for the reset once it's
+	// spent. Nothing is tracked if nil.
+	Limit *RateLimit
+}
+
+func (c *Client) logger() *slog.Logger {
+	return logutil.Or(c.Log)
+}
+
+// DefaultRetry tries a request three times in all, as long as Retryable says so.
+var DefaultRetry = retry.Policy{Attempts: 3, Base: 500 * time.Millisecond, Max: 4 * time.Second, Classify: Retryable}
+
+// StatusError is an error response from the Lifx API, passed to the retry
+// classifier. The request methods report it with the body of the response.
+type StatusError struct {
+	Code int
+	// RetryAfter is how long the API asked to wait, 0 if it didn't say.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("lifx API: %d %s", e.Code, http.StatusText(e.Code))
+}
+
+// Retryable is the default retry.Classifier: rate limits, server errors and
+// requests that never got an answer are worth another try.
+func Retryable(err error) (bool, time.Duration) {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return retry.Status(se.Code), se.RetryAfter
+	}
+	var ue *url.Error
+	return errors.As(err, &ue) && !errors.Is(err, context.Canceled), 0
 }
 
 // Light represents a Lifx light (partial fields).
@@ -24,9 +74,18 @@ type Light struct {
 	Brightness float64 `json:"brightness"`
 }
 
+// Colors used when none is configured for a state.
+const (
+	DefaultBusyColor    = "red saturation:0.5"
+	DefaultFreeColor    = "kelvin:2671"
+	DefaultTeamColor    = "blue saturation:0.5"
+	DefaultErrorColor   = "orange saturation:1.0"
+	DefaultUnknownColor = "purple saturation:0.6"
+)
+
 // NewClient creates a new Lifx API client.
 func NewClient(token string) *Client {
-	return &Client{Token: token, BaseURL: "https://api.lifx.com/v1/"}
+	return &Client{Token: token, BaseURL: "https://api.lifx.com/v1/", Limit: Limits(token)}
 }
 
 // ListLights returns all lights for the account.
@@ -37,14 +96,14 @@ func (c *Client) ListLights() ([]Light, error) {
 		return nil, err
 	}
 	req.Header.Set("Authorization", "Bearer "+c.Token)
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer func(Body io.ReadCloser) {
 		err = Body.Close()
 		if err != nil {
-			fmt.Printf("Error closing response body: %v\n", err)
+			c.logger().Warn("close lifx response body", logutil.Err(err))
 		}
 	}(resp.Body)
 	if resp.StatusCode != 200 {
@@ -66,14 +125,14 @@ func (c *Client) TogglePower(selector string) error {
 		return err
 	}
 	req.Header.Set("Authorization", "Bearer "+c.Token)
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
 	defer func(Body io.ReadCloser) {
 		err = Body.Close()
 		if err != nil {
-			fmt.Printf("Error closing response body: %v\n", err)
+			c.logger().Warn("close lifx response body", logutil.Err(err))
 		}
 	}(resp.Body)
 	if resp.StatusCode != 207 && resp.StatusCode != 200 {
@@ -96,14 +155,14 @@ func (c *Client) SetState(selector string, state map[string]interface{}) error {
 	}
 	req.Header.Set("Authorization", "Bearer "+c.Token)
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
 	defer func(Body io.ReadCloser) {
 		err = Body.Close()
 		if err != nil {
-			fmt.Printf("Error closing response body: %v\n", err)
+			c.logger().Warn("close lifx response body", logutil.Err(err))
 		}
 	}(resp.Body)
 	if resp.StatusCode != 207 && resp.StatusCode != 200 {
@@ -115,20 +174,28 @@ func (c *Client) SetState(selector string, state map[string]interface{}) error {
 
 // SetBusy sets the state of the specified light to busy, using the provided color.
 func (c *Client) SetBusy(light Light, color string) error {
+	return c.SetBusyBrightness(light, color, 0)
+}
+
+// SetBusyBrightness is SetBusy at a brightness between 0 and 1. A brightness of 0 leaves the brightness unchanged.
+func (c *Client) SetBusyBrightness(light Light, color string, brightness float64) error {
 	if color == "" {
-		color = "red saturation:0.5" // fallback default
+		color = DefaultBusyColor
 	}
 	state := map[string]interface{}{
 		"power": "on",
 		"color": color,
 	}
+	if brightness > 0 {
+		state["brightness"] = brightness
+	}
 	return c.SetState("id:"+light.ID, state)
 }
 
 // SetFree sets the state of the specified light to available, using the provided color.
 func (c *Client) SetFree(light Light, color string) error {
 	if color == "" {
-		color = "kelvin:2671" // fallback default
+		color = DefaultFreeColor
 	}
 	state := map[string]interface{}{
 		"power":      "on",
@@ -137,3 +204,207 @@ func (c *Client) SetFree(light Light, color string) error {
 	}
 	return c.SetState("id:"+light.ID, state)
 }
+
+// SetTeam sets the state of the specified light to the team state, using the provided color.
+func (c *Client) SetTeam(light Light, color string) error {
+	if color == "" {
+		color = DefaultTeamColor
+	}
+	state := map[string]interface{}{
+		"power": "on",
+		"color": color,
+	}
+	return c.SetState("id:"+light.ID, state)
+}
+
+// SetUnknown sets the specified light to the color shown while the calendars
+// can't be read, using the provided color.
+func (c *Client) SetUnknown(light Light, color string) error {
+	if color == "" {
+		color = DefaultUnknownColor
+	}
+	state := map[string]interface{}{
+		"power":      "on",
+		"color":      color,
+		"brightness": 0.3,
+	}
+	return c.SetState("id:"+light.ID, state)
+}
+
+// Breathe runs the breathe effect on a light by selector, slowly fading between colors.
+// See https://api.developer.lifx.com/reference/breathe-effect for the parameters.
+func (c *Client) Breathe(selector string, params map[string]interface{}) error {
+	return c.post("lights/"+selector+"/effects/breathe", params)
+}
+
+// EffectsOff stops any running effect on a light by selector.
+func (c *Client) EffectsOff(selector string) error {
+	return c.post("lights/"+selector+"/effects/off", nil)
+}
+
+// SetError makes the specified light blink in the provided color, so it's obvious on-air needs attention.
+// The blinking stops after an hour and leaves the light in the error color.
+func (c *Client) SetError(light Light, color string) error {
+	if color == "" {
+		color = DefaultErrorColor
+	}
+	params := map[string]interface{}{
+		"color":    color,
+		"period":   2,
+		"cycles":   1800,
+		"persist":  true,
+		"power_on": true,
+	}
+	return c.Breathe("id:"+light.ID, params)
+}
+
+// post sends a POST request with an optional JSON body to the path below BaseURL.
+func (c *Client) post(path string, params map[string]interface{}) error {
+	var body io.Reader
+	if params != nil {
+		bodyBytes, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(bodyBytes)
+	}
+	req, err := http.NewRequest("POST", c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	if params != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		err = Body.Close()
+		if err != nil {
+			c.logger().Warn("close lifx response body", logutil.Err(err))
+		}
+	}(resp.Body)
+	if resp.StatusCode != 207 && resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("lifx API error: %s", string(body))
+	}
+	return nil
+}
+
+// splitPath splits a request path, /v1/lights/<selector>/<action...>, into its
+// selector and action.
+func splitPath(p string) (selector, action string) {
+	_, rest, _ := strings.Cut(p, "/lights/")
+	selector, action, _ = strings.Cut(rest, "/")
+	return selector, action
+}
+
+// do sends a request with the client's HTTP client, retrying it as the Retry
+// policy says. A request with a body must be able to rewind it with GetBody, as
+// http.NewRequest does for a bytes.Reader. Error responses are returned with
+// their body once they're not worth retrying.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	selector, _ := splitPath(req.URL.Path)
+	log := c.logger()
+	policy := DefaultRetry
+	if c.Retry != nil {
+		policy = *c.Retry
+	}
+	classify := policy.Classify
+	policy.Classify = func(err error) (bool, time.Duration) {
+		var se *StatusError
+		if strings.HasSuffix(req.URL.Path, "/toggle") && !(errors.As(err, &se) && se.Code == http.StatusTooManyRequests) {
+			// Toggling twice undoes it, so only retry when the API turned the first one down.
+			return false, 0
+		}
+		if classify == nil {
+			return true, 0
+		}
+		return classify(err)
+	}
+	onRetry := policy.OnRetry
+	policy.OnRetry = func(attempt int, wait time.Duration, err error) {
+		log.Warn("lifx request failed, retrying", "method", req.Method, "selector", selector, "attempt", attempt, "backoff", wait, logutil.Err(err))
+		if onRetry != nil {
+			onRetry(attempt, wait, err)
+		}
+	}
+
+	httpClient := c.HTTP
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	var resp *http.Response
+	attempt := 0
+	err := policy.Do(req.Context(), func(ctx context.Context) error {
+		attempt++
+		r := req
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return err
+			}
+			r = req.Clone(ctx)
+			r.Body = body
+		}
+		if _, wait := c.Limit.Budget(time.Now()); wait > 0 {
+			log.Info("lifx rate limit reached, waiting for the reset", "method", req.Method, "selector", selector, "wait", wait)
+			if err := sleep(ctx, wait); err != nil {
+				return err
+			}
+			metrics.LifxRateLimitWait.Add(wait.Seconds())
+		}
+		log.Debug("lifx request", "method", req.Method, "selector", selector, "path", req.URL.Path, "attempt", attempt)
+		var err error
+		resp, err = httpClient.Do(r)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		c.Limit.Update(resp, now)
+		if resp.StatusCode < 400 {
+			return nil
+		}
+		// Keep the body for the caller's error, the connection can go back to the pool.
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		after := retry.ParseRetryAfter(resp.Header.Get("Retry-After"), now)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			metrics.LifxRateLimited.Inc()
+			if after == 0 {
+				after = untilReset(resp.Header, now)
+			}
+		}
+		return &StatusError{Code: resp.StatusCode, RetryAfter: after}
+	})
+	var se *StatusError
+	if err != nil && !errors.As(err, &se) {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// untilReset returns how long until the X-RateLimit-Reset of a response, 0 if it
+// has none or it's past.
+func untilReset(h http.Header, now time.Time) time.Duration {
+	reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil || !time.Unix(reset, 0).After(now) {
+		return 0
+	}
+	return time.Unix(reset, 0).Sub(now)
+}
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -2,10 +2,15 @@ package lifxutil
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"on-air/retry"
 )
 
 func TestNewClient(t *testing.T) {
@@ -175,3 +180,147 @@ func TestSetFree_FallbackColor(t *testing.T) {
 		t.Errorf("SetFree fallback color failed: %v", err)
 	}
 }
+
+func TestSetTeam_FallbackColor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var state map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+			t.Errorf("json decode error: %v", err)
+		}
+		if state["color"] != "blue saturation:0.5" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c := &Client{Token: "test-token", BaseURL: server.URL + "/v1/"}
+
+	light := Light{ID: "test"}
+	if err := c.SetTeam(light, ""); err != nil {
+		t.Errorf("SetTeam fallback color failed: %v", err)
+	}
+}
+
+func TestSetBusyBrightness(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var state map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+			t.Errorf("json decode error: %v", err)
+		}
+		if state["color"] != "red" || state["brightness"] != 0.75 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c := &Client{Token: "test-token", BaseURL: server.URL + "/v1/"}
+
+	light := Light{ID: "test"}
+	if err := c.SetBusyBrightness(light, "red", 0.75); err != nil {
+		t.Errorf("SetBusyBrightness failed: %v", err)
+	}
+}
+
+func TestSetError_Breathes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/v1/lights/id:test/effects/breathe" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var params map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			t.Errorf("json decode error: %v", err)
+		}
+		if params["color"] != "orange saturation:1.0" || params["persist"] != true {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+	}))
+	defer server.Close()
+
+	c := &Client{Token: "test-token", BaseURL: server.URL + "/v1/"}
+
+	light := Light{ID: "test"}
+	if err := c.SetError(light, ""); err != nil {
+		t.Errorf("SetError failed: %v", err)
+	}
+}
+
+func TestEffectsOff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/v1/lights/id:test/effects/off" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+	}))
+	defer server.Close()
+
+	c := &Client{Token: "test-token", BaseURL: server.URL + "/v1/"}
+
+	if err := c.EffectsOff("id:test"); err != nil {
+		t.Errorf("EffectsOff failed: %v", err)
+	}
+}
+
+// quickRetry retries like DefaultRetry without waiting long.
+var quickRetry = &retry.Policy{Attempts: 3, Base: time.Millisecond, Max: time.Millisecond, Classify: Retryable}
+
+func TestSetState_Retry(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		switch len(bodies) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusMultiStatus)
+		}
+	}))
+	defer server.Close()
+
+	c := &Client{Token: "test-token", BaseURL: server.URL + "/v1/", Retry: quickRetry}
+	if err := c.SetState("id:test", map[string]interface{}{"power": "on"}); err != nil {
+		t.Fatalf("SetState failed: %v", err)
+	}
+	if len(bodies) != 3 || bodies[2] != bodies[0] || bodies[0] == "" {
+		t.Errorf("got bodies %q, want the same body sent three times", bodies)
+	}
+}
+
+func TestRetry_GivesUp(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/v1/lights/id:test/state" {
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		_, _ = w.Write([]byte("no luck"))
+	}))
+	defer server.Close()
+
+	c := &Client{Token: "test-token", BaseURL: server.URL + "/v1/", Retry: quickRetry}
+	if err := c.EffectsOff("id:other"); err == nil || !strings.Contains(err.Error(), "no luck") || calls != 3 {
+		t.Errorf("server error: got %v after %d calls, want the body after 3", err, calls)
+	}
+	calls = 0
+	if err := c.SetState("id:test", map[string]interface{}{"power": "on"}); err == nil || calls != 1 {
+		t.Errorf("bad request: got %v after %d calls, want an error after 1", err, calls)
+	}
+	// A toggle that may have gone through isn't sent again.
+	calls = 0
+	if err := c.TogglePower("id:other"); err == nil || calls != 1 {
+		t.Errorf("toggle: got %v after %d calls, want an error after 1", err, calls)
+	}
+}
@@ -0,0 +1,137 @@
+package lifxutil
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"on-air/metrics"
+	"on-air/retry"
+)
+
+// LowBudget is how few requests may be left before the reset for a token to
+// count as near its limit, when light commands are coalesced to the latest state.
+const LowBudget = 10
+
+// rateWindow is how long the Lifx API counts requests for, used when a 429 doesn't
+// say when the budget resets.
+const rateWindow = time.Minute
+
+// RateLimit tracks the request budget of a Lifx token from the X-RateLimit-*
+// headers of its responses. The zero value knows nothing and never holds back.
+type RateLimit struct {
+	mu        sync.Mutex
+	known     bool
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+var (
+	limitsMu sync.Mutex
+	limits   = make(map[string]*RateLimit)
+)
+
+// Limits returns the budget of a token, shared by every client using it.
+func Limits(token string) *RateLimit {
+	limitsMu.Lock()
+	defer limitsMu.Unlock()
+	l, ok := limits[token]
+	if !ok {
+		l = &RateLimit{}
+		limits[token] = l
+	}
+	return l
+}
+
+// Update records the budget a response reports. A 429 spends it until the reset,
+// or its Retry-After, or a minute from now if the response says neither.
+func (l *RateLimit) Update(resp *http.Response, now time.Time) {
+	if l == nil {
+		return
+	}
+	h := resp.Header
+	remaining, err := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	limited := resp.StatusCode == http.StatusTooManyRequests
+	if err != nil && !limited {
+		return
+	}
+
+	l.mu.Lock()
+	l.known = true
+	l.remaining = remaining
+	if limit, err := strconv.Atoi(h.Get("X-RateLimit-Limit")); err == nil {
+		l.limit = limit
+	}
+	if reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		l.reset = time.Unix(reset, 0)
+	}
+	if limited {
+		l.remaining = 0
+		if !l.reset.After(now) {
+			wait := retry.ParseRetryAfter(h.Get("Retry-After"), now)
+			if wait <= 0 {
+				wait = rateWindow
+			}
+			l.reset = now.Add(wait)
+		}
+	}
+	l.mu.Unlock()
+	reportTightest(now)
+}
+
+// left returns the requests the token has left at now, the whole limit once the
+// window has reset, and when the window resets.
+func (l *RateLimit) left(now time.Time) (remaining int, reset time.Time, known bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.known {
+		return 0, time.Time{}, false
+	}
+	if !now.Before(l.reset) && l.limit > 0 {
+		return l.limit, l.reset, true
+	}
+	return l.remaining, l.reset, true
+}
+
+// reportTightest sets the rate limit metrics to the budget of the token with the
+// fewest requests left, the one that holds commands back first. Tokens are never
+// used as labels.
+func reportTightest(now time.Time) {
+	limitsMu.Lock()
+	tracked := make([]*RateLimit, 0, len(limits))
+	for _, l := range limits {
+		tracked = append(tracked, l)
+	}
+	limitsMu.Unlock()
+
+	fewest := -1
+	var reset time.Time
+	for _, l := range tracked {
+		if remaining, r, ok := l.left(now); ok && (fewest < 0 || remaining < fewest) {
+			fewest, reset = remaining, r
+		}
+	}
+	if fewest >= 0 {
+		metrics.LifxRateLimitRemaining.Set(float64(fewest))
+		metrics.LifxRateLimitReset.Set(float64(reset.Unix()))
+	}
+}
+
+// Budget reports whether the token is near its limit, no more than LowBudget
+// requests left before the reset, and how long until the reset once none are left.
+func (l *RateLimit) Budget(now time.Time) (low bool, wait time.Duration) {
+	if l == nil {
+		return false, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.known || !now.Before(l.reset) {
+		return false, 0 // a new window has begun
+	}
+	if l.remaining <= 0 {
+		return true, l.reset.Sub(now)
+	}
+	return l.remaining <= LowBudget, 0
+}
@@ -0,0 +1,128 @@
+package lifxutil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"on-air/metrics"
+)
+
+func rateHeaders(remaining int, reset time.Time) http.Header {
+	return http.Header{
+		"X-Ratelimit-Limit":     {"120"},
+		"X-Ratelimit-Remaining": {strconv.Itoa(remaining)},
+		"X-Ratelimit-Reset":     {strconv.FormatInt(reset.Unix(), 10)},
+	}
+}
+
+func TestRateLimit_Budget(t *testing.T) {
+	now := time.Unix(1792400000, 0)
+	reset := now.Add(30 * time.Second)
+	var l RateLimit
+	if low, wait := l.Budget(now); low || wait != 0 {
+		t.Errorf("unknown: got %v, %v, want plenty", low, wait)
+	}
+
+	l.Update(&http.Response{StatusCode: http.StatusOK, Header: rateHeaders(100, reset)}, now)
+	if low, wait := l.Budget(now); low || wait != 0 {
+		t.Errorf("100 left: got %v, %v, want plenty", low, wait)
+	}
+	l.Update(&http.Response{StatusCode: http.StatusOK, Header: rateHeaders(LowBudget, reset)}, now)
+	if low, wait := l.Budget(now); !low || wait != 0 {
+		t.Errorf("%d left: got %v, %v, want low without waiting", LowBudget, low, wait)
+	}
+	l.Update(&http.Response{StatusCode: http.StatusOK, Header: rateHeaders(0, reset)}, now)
+	if low, wait := l.Budget(now); !low || wait != 30*time.Second {
+		t.Errorf("none left: got %v, %v, want to wait 30s", low, wait)
+	}
+	if low, wait := l.Budget(reset); low || wait != 0 {
+		t.Errorf("after the reset: got %v, %v, want plenty", low, wait)
+	}
+
+	// A 429 without headers spends the budget for a minute.
+	l.Update(&http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}, reset)
+	if _, wait := l.Budget(reset); wait != rateWindow {
+		t.Errorf("429: got to wait %v, want %v", wait, rateWindow)
+	}
+	later := reset.Add(rateWindow)
+	l.Update(&http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"5"}}}, later)
+	if _, wait := l.Budget(later); wait != 5*time.Second {
+		t.Errorf("429 with Retry-After: got to wait %v, want 5s", wait)
+	}
+}
+
+func TestClient_WaitsForReset(t *testing.T) {
+	reset := time.Unix(time.Now().Add(time.Second).Unix(), 0)
+	var times []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		times = append(times, time.Now())
+		remaining := 0
+		if len(times) > 1 {
+			remaining = 119
+		}
+		for k, v := range rateHeaders(remaining, reset) {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c := &Client{Token: "test-token", BaseURL: server.URL + "/v1/", Limit: &RateLimit{}}
+	for i := 0; i < 2; i++ {
+		if err := c.EffectsOff("id:test"); err != nil {
+			t.Fatalf("EffectsOff: %v", err)
+		}
+	}
+	if len(times) != 2 || times[1].Before(reset) {
+		t.Errorf("second request at %v, want after the reset at %v", times[len(times)-1], reset)
+	}
+	if low, wait := c.Limit.Budget(time.Now()); low || wait != 0 {
+		t.Errorf("budget after the reset: got %v, %v, want plenty", low, wait)
+	}
+}
+
+func TestUntilReset(t *testing.T) {
+	now := time.Unix(1792400000, 0)
+	if got := untilReset(rateHeaders(0, now.Add(20*time.Second)), now); got != 20*time.Second {
+		t.Errorf("got %v, want 20s", got)
+	}
+	if got := untilReset(http.Header{}, now); got != 0 {
+		t.Errorf("no header: got %v, want 0", got)
+	}
+}
+
+func TestRateLimit_Metrics(t *testing.T) {
+	gauge := func() string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		for _, line := range strings.Split(rec.Body.String(), "\n") {
+			if strings.HasPrefix(line, "onair_lifx_rate_limit_remaining ") {
+				return line
+			}
+		}
+		return ""
+	}
+	now := time.Now()
+	ok := func(remaining int) *http.Response {
+		return &http.Response{StatusCode: http.StatusOK, Header: rateHeaders(remaining, now.Add(time.Minute))}
+	}
+
+	// Sinks with different tokens don't overwrite each other: the tightest budget wins.
+	Limits("metrics-a").Update(ok(100), now)
+	Limits("metrics-b").Update(ok(5), now)
+	Limits("metrics-a").Update(ok(99), now)
+	if got := gauge(); got != "onair_lifx_rate_limit_remaining 5" {
+		t.Errorf("got %q, want the 5 left on the tightest token", got)
+	}
+	// Once its window resets the token has its whole limit again.
+	later := now.Add(2 * time.Minute)
+	Limits("metrics-a").Update(&http.Response{StatusCode: http.StatusOK, Header: rateHeaders(98, later.Add(time.Minute))}, later)
+	if got := gauge(); got != "onair_lifx_rate_limit_remaining 98" {
+		t.Errorf("after metrics-b reset: got %q, want 98", got)
+	}
+}
@@ -0,0 +1,174 @@
+package lifxutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"on-air/logutil"
+)
+
+// Call is a request a Client made to the Lifx API.
+type Call struct {
+	Time   time.Time              `json:"time"`
+	Method string                 `json:"method"`
+	URL    string                 `json:"url"`
+	Body   map[string]interface{} `json:"body,omitempty"`
+}
+
+// VirtualLight is the state a light would be in after the recorded calls.
+type VirtualLight struct {
+	Selector   string    `json:"selector"`
+	Power      string    `json:"power"`
+	Color      string    `json:"color,omitempty"`
+	Brightness float64   `json:"brightness,omitempty"`
+	Effect     string    `json:"effect,omitempty"`
+	Updated    time.Time `json:"updated"`
+}
+
+// Recorder stands in for the Lifx API in dry runs. It's an http.RoundTripper that
+// logs and records every request instead of sending it, and keeps the state the
+// lights would be in.
+type Recorder struct {
+	mu     sync.Mutex
+	calls  []Call
+	lights map[string]*VirtualLight
+	// Now returns the time calls are recorded at, time.Now if nil.
+	Now func() time.Time
+	// Log is where calls are logged, slog.Default() if nil.
+	Log *slog.Logger
+}
+
+// NewRecorder returns a Recorder with no calls and no lights.
+func NewRecorder() *Recorder {
+	return &Recorder{lights: make(map[string]*VirtualLight)}
+}
+
+// Client returns a Lifx client whose requests go to the recorder.
+func (r *Recorder) Client(token string) *Client {
+	c := NewClient(token)
+	c.HTTP = &http.Client{Transport: r}
+	c.Log = r.Log
+	c.Limit = nil // nothing is sent, so there is no budget to spend
+	return c
+}
+
+// RoundTrip records the request and answers it like the Lifx API would.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body map[string]interface{}
+	if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		_ = req.Body.Close()
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &body); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	r.mu.Lock()
+	now := time.Now()
+	if r.Now != nil {
+		now = r.Now()
+	}
+	call := Call{Time: now, Method: req.Method, URL: req.URL.String(), Body: body}
+	r.calls = append(r.calls, call)
+	reply := r.apply(call, req.URL.Path)
+	r.mu.Unlock()
+
+	selector, _ := splitPath(req.URL.Path)
+	bodyJSON, _ := json.Marshal(body)
+	logutil.Or(r.Log).Info("dry run", "method", call.Method, "selector", selector, "url", call.URL, "body", string(bodyJSON))
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(data)),
+		Request:    req,
+	}, nil
+}
+
+// apply updates the virtual lights for a call and returns the reply to send.
+func (r *Recorder) apply(call Call, path string) interface{} {
+	selector, action := splitPath(path)
+	if selector == "all" && action == "" {
+		return r.list()
+	}
+	l, ok := r.lights[selector]
+	if !ok {
+		l = &VirtualLight{Selector: selector, Power: "off"}
+		r.lights[selector] = l
+	}
+	l.Updated = call.Time
+
+	switch action {
+	case "state":
+		if p, ok := call.Body["power"].(string); ok {
+			l.Power = p
+		}
+		if c, ok := call.Body["color"].(string); ok {
+			l.Color = c
+		}
+		if b, ok := call.Body["brightness"].(float64); ok {
+			l.Brightness = b
+		}
+	case "toggle":
+		if l.Power == "on" {
+			l.Power = "off"
+		} else {
+			l.Power = "on"
+		}
+	case "effects/breathe":
+		l.Effect = "breathe"
+		if c, ok := call.Body["color"].(string); ok {
+			l.Color = c
+		}
+		if on, _ := call.Body["power_on"].(bool); on {
+			l.Power = "on"
+		}
+	case "effects/off":
+		l.Effect = ""
+	}
+	return map[string]interface{}{"results": []map[string]string{{"id": selector, "status": "ok"}}}
+}
+
+// list returns the virtual lights as the lights endpoint would.
+func (r *Recorder) list() []Light {
+	var lights []Light
+	for _, l := range r.lights {
+		lights = append(lights, Light{ID: strings.TrimPrefix(l.Selector, "id:"), Power: l.Power, Color: l.Color, Brightness: l.Brightness})
+	}
+	sort.Slice(lights, func(i, j int) bool { return lights[i].ID < lights[j].ID })
+	return lights
+}
+
+// Calls returns the calls recorded so far.
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// Lights returns the virtual state of every light a call was made for, by selector.
+func (r *Recorder) Lights() []VirtualLight {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	lights := make([]VirtualLight, 0, len(r.lights))
+	for _, l := range r.lights {
+		lights = append(lights, *l)
+	}
+	sort.Slice(lights, func(i, j int) bool { return lights[i].Selector < lights[j].Selector })
+	return lights
+}
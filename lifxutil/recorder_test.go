@@ -0,0 +1,54 @@
+package lifxutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder()
+	c := r.Client("token")
+	light := Light{ID: "d073d5000001"}
+
+	if err := c.SetBusyBrightness(light, "red", 0.5); err != nil {
+		t.Fatalf("SetBusyBrightness: %v", err)
+	}
+	if err := c.SetError(light, ""); err != nil {
+		t.Fatalf("SetError: %v", err)
+	}
+	lights := r.Lights()
+	if len(lights) != 1 {
+		t.Fatalf("Lights: got %+v, want one", lights)
+	}
+	l := lights[0]
+	if l.Selector != "id:d073d5000001" || l.Power != "on" || l.Color != DefaultErrorColor || l.Brightness != 0.5 || l.Effect != "breathe" {
+		t.Errorf("virtual light: got %+v", l)
+	}
+
+	if err := c.EffectsOff("id:" + light.ID); err != nil {
+		t.Fatalf("EffectsOff: %v", err)
+	}
+	if err := c.SetFree(light, "kelvin:3500"); err != nil {
+		t.Fatalf("SetFree: %v", err)
+	}
+	if l := r.Lights()[0]; l.Effect != "" || l.Color != "kelvin:3500" {
+		t.Errorf("virtual light after free: got %+v", l)
+	}
+
+	calls := r.Calls()
+	if len(calls) != 4 {
+		t.Fatalf("Calls: got %d, want 4", len(calls))
+	}
+	first := calls[0]
+	if first.Method != "PUT" || first.URL != "https://api.lifx.com/v1/lights/id:d073d5000001/state" || first.Body["color"] != "red" {
+		t.Errorf("first call: got %+v", first)
+	}
+	if !strings.HasSuffix(calls[1].URL, "/effects/breathe") || !strings.HasSuffix(calls[2].URL, "/effects/off") {
+		t.Errorf("effect calls: got %s, %s", calls[1].URL, calls[2].URL)
+	}
+
+	got, err := c.ListLights()
+	if err != nil || len(got) != 1 || got[0].ID != light.ID {
+		t.Errorf("ListLights: got %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"on-air/lifxutil"
+	"on-air/schedule"
+)
+
+// lightsCommand runs the "lights" subcommands.
+func lightsCommand(args []string) {
+	usage := "usage: on-air lights list [-config path] | on-air lights set [-config path] busy|free|team|error|unknown"
+	if len(args) == 0 || (args[0] != "list" && args[0] != "set") {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("lights "+args[0], flag.ExitOnError)
+	configPath := configFlag(fs)
+	settingFlags(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		log.Fatal(err)
+	}
+	manager := &schedule.Manager{Settings: settings(loadConfig(*configPath, fs))}
+
+	if args[0] == "list" {
+		listLights(manager.Sinks)
+		return
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	state := schedule.State(fs.Arg(0))
+	switch state {
+	case schedule.Busy, schedule.Free, schedule.Team, schedule.Error, schedule.Unknown:
+	default:
+		fmt.Fprintf(os.Stderr, "unknown state %q\n%s\n", state, usage)
+		os.Exit(2)
+	}
+	// A running instance puts the lights back at its next state change or config reload.
+	if err := manager.Show(state); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Set the lights to %s\n", state)
+}
+
+// listLights prints the lights on the accounts of the sinks, marking the configured ones.
+func listLights(sinks []schedule.Sink) {
+	seen := make(map[string]bool)
+	for _, s := range sinks {
+		if seen[s.Token] {
+			continue
+		}
+		seen[s.Token] = true
+		lights, err := lifxutil.NewClient(s.Token).ListLights()
+		if err != nil {
+			log.Fatalf("list lights: %v", err)
+		}
+		for _, l := range lights {
+			mark := " "
+			for _, configured := range sinks {
+				if configured.LightID == l.ID {
+					mark = "*"
+				}
+			}
+			fmt.Printf("%s %-14s %-24s %s\n", mark, l.ID, l.Label, l.Power)
+		}
+	}
+}
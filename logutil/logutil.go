@@ -0,0 +1,74 @@
+// Package logutil builds the structured logger the other packages log through.
+package logutil
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Redacted replaces the value of attributes that look like secrets.
+const Redacted = "[redacted]"
+
+// secretKeys are attribute keys whose values are never written out.
+var secretKeys = map[string]bool{
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"lifx_token":    true,
+	"authorization": true,
+	"password":      true,
+	"secret":        true,
+	"client_secret": true,
+}
+
+// New returns a logger writing to w. format is "text" or "json", level one of
+// "debug", "info", "warn" or "error"; empty ones mean text and info.
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: lvl, ReplaceAttr: redact}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("log format %q is not one of text, json", format)
+}
+
+// ParseLevel parses a level name, empty meaning info.
+func ParseLevel(s string) (slog.Level, error) {
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("log level %q is not one of debug, info, warn, error", s)
+	}
+	return lvl, nil
+}
+
+// Err is the attribute errors are logged under.
+func Err(err error) slog.Attr {
+	return slog.Any("err", err)
+}
+
+// redact blanks out attributes with a secret key, wherever they're nested.
+func redact(_ []string, a slog.Attr) slog.Attr {
+	if secretKeys[strings.ToLower(a.Key)] && a.Value.Kind() != slog.KindGroup {
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
+
+// Or returns log, or the default logger when it's nil.
+func Or(log *slog.Logger) *slog.Logger {
+	if log != nil {
+		return log
+	}
+	return slog.Default()
+}
@@ -0,0 +1,66 @@
+package logutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNew_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := New(&buf, "json", "debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Debug("light set", "state", "busy", "selector", "id:d073d5000001", "token", "c0ffee", Err(errors.New("boom")))
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("not JSON: %v: %s", err, buf.String())
+	}
+	want := map[string]interface{}{
+		"level": "DEBUG", "msg": "light set", "state": "busy",
+		"selector": "id:d073d5000001", "token": Redacted, "err": "boom",
+	}
+	for k, v := range want {
+		if line[k] != v {
+			t.Errorf("%s: got %v, want %v", k, line[k], v)
+		}
+	}
+}
+
+func TestNew_Level(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := New(&buf, "text", "warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Info("schedule reloaded")
+	log.Warn("freebusy query failed", "attempt", 1)
+	if out := buf.String(); strings.Contains(out, "reloaded") || !strings.Contains(out, "attempt=1") {
+		t.Errorf("got %q, want only the warning", out)
+	}
+}
+
+func TestNew_Redacts(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := New(&buf, "text", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Info("config", "sink", map[string]string{"type": "lifx"}, "Access_Token", "ya29.secret")
+	if strings.Contains(buf.String(), "ya29.secret") {
+		t.Errorf("secret was logged: %s", buf.String())
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "xml", ""); err == nil {
+		t.Error("format xml: expected an error")
+	}
+	if _, err := New(&bytes.Buffer{}, "", "loud"); err == nil {
+		t.Error("level loud: expected an error")
+	}
+}
@@ -2,89 +2,193 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
+	"on-air/auth"
 	"on-air/configutil"
 	"on-air/lifxutil"
+	"on-air/logutil"
+	"on-air/metrics"
 	"on-air/schedule"
+	"on-air/server"
 )
 
-func main() {
-	var (
-		configPath            = flag.String("config", "config.json", "path to config file")
-		credsPath             = flag.String("credentials", "", "path to OAuth client JSON")
-		tokenPath             = flag.String("token", "", "path to store OAuth tokens")
-		calID                 = flag.String("calendar", "", "calendar ID or 'primary'")
-		days                  = flag.Int("days", 0, "how many days ahead to check")
-		lifxToken             = flag.String("lifx_token", "", "Lifx API token")
-		lifxLightID           = flag.String("lifx_light_id", "", "Lifx Light ID")
-		lifxLightLabel        = flag.String("lifx_light_label", "", "Lifx Light Label")
-		lifxBusyColor         = flag.String("lifx_busy_color", "", "Lifx Busy Color")
-		lifxFreeColor         = flag.String("lifx_free_color", "", "Lifx Free Color")
-		reloadIntervalSeconds = flag.Int("reload_interval_seconds", 0, "Reload interval in seconds")
-	)
-	flag.Parse()
-
-	cfg, err := configutil.LoadConfig(*configPath)
-	if err != nil {
-		log.Fatalf("failed to load config: %v", err)
-	}
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
 
-	// Override config values with flags if provided
-	if *credsPath != "" {
-		cfg.CredsPath = *credsPath
-	}
-	if *tokenPath != "" {
-		cfg.TokenPath = *tokenPath
-	}
-	if *calID != "" {
-		cfg.CalID = *calID
-	}
-	if *days != 0 {
-		cfg.Days = *days
-	}
-	if *lifxToken != "" {
-		cfg.LifxToken = *lifxToken
+const usage = `usage: on-air [command] [flags]
+
+Commands:
+  run              watch the calendars and drive the lights (the default)
+  status           show the state of a running instance
+  lights list      list the lights on the LIFX account
+  lights set STATE set the lights to busy, free, team, error or unknown
+  schedule show    print the upcoming busy blocks
+  schedule agenda  print the state changes over the days ahead
+  simulate         replay a day on a virtual clock and report what the lights would do
+  auth login       authorize a Google account
+  auth logout      forget the saved Google token
+  auth revoke      revoke the Google grant and forget the token
+  config check     validate the config
+  config migrate   upgrade the config file to the current version
+  secrets          generate keys and seal secrets
+  init             set up a new config interactively
+  version          print the version
+
+Run "on-air <command> -h" for the flags of a command.`
+
+// commands are the subcommands by name, run with the arguments after it.
+var commands = map[string]func(args []string){
+	"run":      runCommand,
+	"status":   statusCommand,
+	"lights":   lightsCommand,
+	"schedule": scheduleCommand,
+	"simulate": simulateCommand,
+	"auth":     authCommand,
+	"config":   configCommand,
+	"secrets":  secretsCommand,
+	"init":     initCommand,
+	"version":  versionCommand,
+}
+
+func main() {
+	args := os.Args[1:]
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		switch {
+		case len(args) > 0 && (args[0] == "-version" || args[0] == "--version"):
+			versionCommand(nil)
+		case len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help"):
+			fmt.Println(usage)
+		default:
+			// Plain "on-air -config ..." keeps running the daemon
+			runCommand(args)
+		}
+		return
 	}
-	if *lifxLightID != "" {
-		cfg.LifxLightID = *lifxLightID
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s\n", args[0], usage)
+		os.Exit(2)
 	}
-	if *lifxLightLabel != "" {
-		cfg.LifxLightLabel = *lifxLightLabel
+	cmd(args[1:])
+}
+
+// versionCommand prints the version.
+func versionCommand(args []string) {
+	fmt.Printf("on-air %s\n", version)
+}
+
+// configFlag adds the -config flag every command reading the config takes.
+func configFlag(fs *flag.FlagSet) *string {
+	return fs.String("config", "config.json", "path to config file (.json, .yaml or .toml)")
+}
+
+// settingFlags adds flags named after the flat config keys they override, see configutil.Load.
+func settingFlags(fs *flag.FlagSet) {
+	fs.String("credentials", "", "path to OAuth client JSON")
+	fs.String("token", "", "path to store OAuth tokens")
+	fs.String("calendar", "", "calendar ID or 'primary'")
+	fs.Int("days", 0, "how many days ahead to check")
+	fs.String("lifx_token", "", "Lifx API token")
+	fs.String("lifx_light_id", "", "Lifx Light ID")
+	fs.String("lifx_light_label", "", "Lifx Light Label")
+	fs.String("lifx_busy_color", "", "Lifx Busy Color")
+	fs.String("lifx_free_color", "", "Lifx Free Color")
+	fs.String("lifx_team_color", "", "Lifx Team Color")
+	fs.String("lifx_error_color", "", "Lifx Error Color")
+	fs.String("lifx_unknown_color", "", "Lifx color while the calendars can't be read")
+	fs.Int("reload_interval_seconds", 0, "Reload interval in seconds")
+	fs.String("status_addr", "", "address to serve /status on, e.g. 127.0.0.1:8080")
+}
+
+// logFlags adds the -log-format and -log-level flags. The returned func builds
+// the logger once fs is parsed and makes it the default, so anything still using
+// the log package goes through it too.
+func logFlags(fs *flag.FlagSet) func() *slog.Logger {
+	format := fs.String("log-format", "text", "log format, text or json")
+	level := fs.String("log-level", "info", "log level, debug, info, warn or error")
+	return func() *slog.Logger {
+		logger, err := logutil.New(os.Stderr, *format, *level)
+		if err != nil {
+			log.Fatal(err)
+		}
+		slog.SetDefault(logger)
+		return logger
 	}
-	if *lifxBusyColor != "" {
-		cfg.LifxBusyColor = *lifxBusyColor
+}
+
+// loadConfig loads the config at path, overridden by ONAIR_* environment variables
+// and the setting flags set on fs if any, validates it and opens its secret store.
+// It exits if any of that fails.
+func loadConfig(path string, fs *flag.FlagSet) *configutil.Config {
+	cfg, err := configutil.Load(path, os.Environ(), fs)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
 	}
-	if *lifxFreeColor != "" {
-		cfg.LifxFreeColor = *lifxFreeColor
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
 	}
-	if *reloadIntervalSeconds != 0 {
-		cfg.ReloadIntervalSeconds = *reloadIntervalSeconds
+	return cfg
+}
+
+// runCommand watches the calendars and drives the lights until it's stopped.
+func runCommand(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	configPath := configFlag(fs)
+	dryRun := fs.Bool("dry-run", false, "log the light calls instead of making them, the virtual lights show in status")
+	newLogger := logFlags(fs)
+	settingFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
 	}
+	logger := newLogger()
+
+	// Flags win over ONAIR_* environment variables, which win over the config file
+	cfg := loadConfig(*configPath, fs)
+	logger.Info("on-air starting", "version", version)
 
-	manager := &schedule.Manager{
-		CredsPath:             cfg.CredsPath,
-		TokenPath:             cfg.TokenPath,
-		CalID:                 cfg.CalID,
-		Days:                  cfg.Days,
-		LifxToken:             cfg.LifxToken,
-		LifxLightID:           cfg.LifxLightID,
-		LifxLightLabel:        cfg.LifxLightLabel,
-		LifxBusyColor:         cfg.LifxBusyColor,
-		LifxFreeColor:         cfg.LifxFreeColor,
-		ReloadIntervalSeconds: cfg.ReloadIntervalSeconds,
+	manager := &schedule.Manager{Settings: settings(cfg), Log: logger, StatePath: cfg.StateFile}
+	if *dryRun {
+		logger.Info("dry run, the lights won't be touched")
+		manager.DryRun = lifxutil.NewRecorder()
+		manager.DryRun.Log = logger
+		manager.StatePath = "" // the virtual lights mustn't be taken for the real ones next run
+	}
+	// Start from the previous run's schedule, in case the calendars can't be read yet
+	if err := manager.Restore(); err != nil {
+		logger.Warn("restore state, starting without it", logutil.Err(err))
 	}
-	manager.Update(manager.LoadSchedule()) // initial load
+	_ = manager.Reload() // initial load, failures are logged and retried by the Reloader
 
 	actionCh := make(chan schedule.Action, 10) // buffered channel
+	metrics.QueueDepth(func() int { return len(actionCh) })
 
 	go schedule.Reloader(manager)
-	go schedule.ActionWorker(actionCh, cfg.LifxToken, cfg.LifxLightID, cfg.LifxLightLabel, cfg.LifxBusyColor, cfg.LifxFreeColor)
+	go schedule.ActionWorker(actionCh, manager)
 	go schedule.Executor(manager, actionCh)
+	go watchConfig(*configPath, fs, cfg, manager)
+
+	var watcher *schedule.Watcher
+	if cfg.StatusAddr != "" {
+		mux := server.Handler(manager)
+		if cfg.WatchURL != "" {
+			watcher = watch(mux, manager, cfg.WatchURL)
+		}
+		go func() {
+			if err := server.ListenAndServe(cfg.StatusAddr, mux); err != nil {
+				logger.Error("status server", logutil.Err(err))
+			}
+		}()
+	}
 
 	// Signal handling for graceful shutdown
 	// TODO: make this cleaner
@@ -92,22 +196,75 @@ func main() {
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		sig := <-sigs
-		log.Printf("Received signal %v, setting light to free state and exiting...", sig)
-		lifxc := lifxutil.NewClient(cfg.LifxToken)
-		if err != nil {
-			log.Printf("Failed to create Lifx client: %v", err)
-			os.Exit(1)
-		}
-		light := lifxutil.Light{
-			ID:    cfg.LifxLightID,
-			Label: cfg.LifxLightLabel,
+		logger.Info("received signal, setting the lights to free and exiting", "signal", sig.String())
+		if err := manager.Show(schedule.Free); err != nil {
+			logger.Error("set lights", "state", schedule.Free, logutil.Err(err))
 		}
-		err = lifxc.SetFree(light, cfg.LifxFreeColor)
-		if err != nil {
-			log.Printf("Failed to set light to free state: %v", err)
+		if watcher != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			watcher.Close(ctx)
+			cancel()
 		}
 		os.Exit(0)
 	}()
 
 	select {} // block forever
 }
+
+// calendars converts configured calendars to their schedule policies.
+func calendars(cfgs []configutil.CalendarConfig) []schedule.Calendar {
+	var cals []schedule.Calendar
+	for _, c := range cfgs {
+		cals = append(cals, schedule.Calendar{
+			ID:          c.ID,
+			Role:        schedule.Role(c.Role),
+			IgnoreFrom:  c.IgnoreFrom,
+			IgnoreUntil: c.IgnoreUntil,
+		})
+	}
+	return cals
+}
+
+// settings converts a config to the schedule manager's settings.
+func settings(cfg *configutil.Config) schedule.Settings {
+	// Load already opened the store, so this doesn't fail for a loaded config.
+	store, _ := cfg.Secrets()
+	var people []schedule.Person
+	for _, src := range cfg.Sources {
+		people = append(people, schedule.Person{
+			Name:      src.Name,
+			Auth:      auth.Mode(src.AuthMode),
+			CredsPath: src.CredsPath,
+			TokenPath: src.TokenPath,
+			KeyPath:   src.ServiceAccountKey,
+			Subject:   src.Subject,
+			Calendars: calendars(src.Calendars),
+			Secrets:   store,
+			Watch:     cfg.WatchURL != "",
+		})
+	}
+	var sinks []schedule.Sink
+	for _, s := range cfg.Sinks {
+		sinks = append(sinks, schedule.Sink{
+			Type:         s.Type,
+			Token:        s.Token,
+			LightID:      s.LightID,
+			LightLabel:   s.LightLabel,
+			BusyColor:    s.Colors.Busy,
+			FreeColor:    s.Colors.Free,
+			TeamColor:    s.Colors.Team,
+			ErrorColor:   s.Colors.Error,
+			UnknownColor: s.Colors.Unknown,
+		})
+	}
+
+	return schedule.Settings{
+		People:                people,
+		Sinks:                 sinks,
+		Occupancy:             schedule.Occupancy(cfg.Rules.Occupancy),
+		Days:                  cfg.Rules.Days,
+		ReloadIntervalSeconds: cfg.Rules.ReloadIntervalSeconds,
+		MaxReloadFailures:     cfg.Rules.MaxReloadFailures,
+		StaleAfterSeconds:     cfg.Rules.StaleAfterSeconds,
+	}
+}
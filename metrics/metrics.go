@@ -0,0 +1,158 @@
+// Package metrics holds the Prometheus metrics of a running instance.
+package metrics
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// State is 1 for the state the light is in.
+	State = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "onair_state",
+		Help: "The current state, 1 for the state the light is in.",
+	}, []string{"state"})
+
+	// Reloads counts schedule reloads by result, "success" or "failure".
+	Reloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "onair_schedule_reloads_total",
+		Help: "Schedule reloads by result.",
+	}, []string{"result"})
+
+	// ReloadDuration is how long schedule reloads take.
+	ReloadDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "onair_schedule_reload_duration_seconds",
+		Help:    "How long schedule reloads take.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+	})
+
+	// FreeBusyRetries counts retried free/busy queries.
+	FreeBusyRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "onair_freebusy_retries_total",
+		Help: "Free/busy queries retried after an error.",
+	})
+
+	// BusyBlocks is the number of blocks in the current schedule.
+	BusyBlocks = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "onair_busy_blocks",
+		Help: "Blocks in the loaded schedule.",
+	})
+
+	// EventSyncs counts event reads by kind, "full" or "incremental".
+	EventSyncs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "onair_event_syncs_total",
+		Help: "Event reads of calendars by kind, full or incremental.",
+	}, []string{"kind"})
+
+	// LightCommands counts light commands by backend and result, "success" or "failure".
+	LightCommands = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "onair_light_commands_total",
+		Help: "Light commands by backend and result.",
+	}, []string{"backend", "result"})
+
+	// CoalescedCommands counts light commands dropped for a later one while near the LIFX rate limit.
+	CoalescedCommands = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "onair_light_commands_coalesced_total",
+		Help: "Light commands skipped for a later one while near the LIFX rate limit.",
+	})
+
+	// LifxRateLimitRemaining is how many LIFX requests are left before the reset,
+	// for the token with the fewest left.
+	LifxRateLimitRemaining = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "onair_lifx_rate_limit_remaining",
+		Help: "LIFX API requests left before the rate limit resets, for the token with the fewest left.",
+	})
+
+	// LifxRateLimitReset is when the LIFX rate limit of that token resets, as a Unix time.
+	LifxRateLimitReset = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "onair_lifx_rate_limit_reset_timestamp_seconds",
+		Help: "When the LIFX API rate limit of the token with the fewest requests left resets.",
+	})
+
+	// LifxRateLimited counts LIFX requests turned down with 429 Too Many Requests.
+	LifxRateLimited = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "onair_lifx_rate_limited_total",
+		Help: "LIFX API requests turned down for the rate limit.",
+	})
+
+	// LifxRateLimitWait is how long LIFX requests waited for the rate limit to reset.
+	LifxRateLimitWait = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "onair_lifx_rate_limit_wait_seconds_total",
+		Help: "Time LIFX API requests spent waiting for the rate limit to reset.",
+	})
+
+	// TokenExpiry is when the OAuth access token saved at a path expires, as a Unix time.
+	TokenExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "onair_oauth_token_expiry_timestamp_seconds",
+		Help: "When the OAuth access token expires, by token file.",
+	}, []string{"token"})
+)
+
+// lastReload is the Unix time of the last successful reload, 0 before the first.
+var lastReload atomic.Int64
+
+// Registry holds the on-air metrics along with the Go and process ones.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		State, Reloads, ReloadDuration, FreeBusyRetries, BusyBlocks, EventSyncs, LightCommands, TokenExpiry,
+		CoalescedCommands, LifxRateLimitRemaining, LifxRateLimitReset, LifxRateLimited, LifxRateLimitWait,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "onair_seconds_since_last_reload",
+			Help: "Seconds since the schedule was last reloaded successfully, -1 before the first.",
+		}, func() float64 {
+			last := lastReload.Load()
+			if last == 0 {
+				return -1
+			}
+			return time.Since(time.Unix(last, 0)).Seconds()
+		}),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// SetState marks state as the current one.
+func SetState(state string) {
+	State.Reset()
+	State.WithLabelValues(state).Set(1)
+}
+
+// Reloaded records a schedule reload that took d.
+func Reloaded(ok bool, d time.Duration) {
+	ReloadDuration.Observe(d.Seconds())
+	if !ok {
+		Reloads.WithLabelValues("failure").Inc()
+		return
+	}
+	Reloads.WithLabelValues("success").Inc()
+	lastReload.Store(time.Now().Unix())
+}
+
+// LightCommand records the result of a light command sent through backend.
+func LightCommand(backend string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	LightCommands.WithLabelValues(backend, result).Inc()
+}
+
+// QueueDepth reports the depth of the action queue through depth.
+func QueueDepth(depth func() int) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "onair_action_queue_depth",
+		Help: "Actions waiting to be sent to the lights.",
+	}, func() float64 { return float64(depth()) }))
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestHandler(t *testing.T) {
+	SetState("busy")
+	SetState("free")
+	Reloaded(true, 200*time.Millisecond)
+	Reloaded(false, time.Second)
+	LightCommand("dry_run", nil)
+	LightCommand("lifx", errors.New("boom"))
+	BusyBlocks.Set(3)
+
+	body := scrape(t)
+	for _, want := range []string{
+		`onair_state{state="free"} 1`,
+		`onair_schedule_reloads_total{result="success"} 1`,
+		`onair_schedule_reloads_total{result="failure"} 1`,
+		`onair_schedule_reload_duration_seconds_count 2`,
+		`onair_light_commands_total{backend="dry_run",result="success"} 1`,
+		`onair_light_commands_total{backend="lifx",result="failure"} 1`,
+		`onair_busy_blocks 3`,
+		`onair_seconds_since_last_reload 0`,
+		`onair_freebusy_retries_total 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics don't contain %q", want)
+		}
+	}
+	if strings.Contains(body, `onair_state{state="busy"}`) {
+		t.Errorf("previous state is still reported")
+	}
+}
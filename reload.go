@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"on-air/configutil"
+	"on-air/logutil"
+	"on-air/schedule"
+)
+
+// configPollInterval is how often the config file is checked for changes.
+const configPollInterval = 2 * time.Second
+
+// watchConfig reloads the config when the file changes or on SIGHUP. The setting
+// flags on fs keep overriding the file.
+func watchConfig(path string, fs *flag.FlagSet, running *configutil.Config, m *schedule.Manager) {
+	changed := make(chan struct{}, 1)
+	go configutil.Watch(path, configPollInterval, changed)
+	hups := make(chan os.Signal, 1)
+	signal.Notify(hups, syscall.SIGHUP)
+
+	for {
+		select {
+		case <-changed:
+			slog.Info("config changed, reloading", "path", path)
+		case <-hups:
+			slog.Info("received SIGHUP, reloading config", "path", path)
+		}
+		running = reloadConfig(path, fs, running, m)
+	}
+}
+
+// reloadConfig loads and validates the config again, then swaps it into the manager.
+// A config that doesn't load or validate is rejected and the running one kept.
+func reloadConfig(path string, fs *flag.FlagSet, running *configutil.Config, m *schedule.Manager) *configutil.Config {
+	cfg, err := configutil.Load(path, os.Environ(), fs)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		slog.Error("rejected new config, keeping the running one", logutil.Err(err))
+		return running
+	}
+	if cfg.StatusAddr != running.StatusAddr || cfg.StateFile != running.StateFile || cfg.WatchURL != running.WatchURL {
+		slog.Warn("status_addr, state_file and watch_url changes take effect after a restart")
+	}
+	m.Reconfigure(settings(cfg))
+	slog.Info("reloaded config", "path", path)
+	return cfg
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"on-air/configutil"
+	"on-air/schedule"
+)
+
+func TestReloadConfig(t *testing.T) {
+	dir := t.TempDir()
+	creds := filepath.Join(dir, "credentials.json")
+	if err := os.WriteFile(creds, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.json")
+	write := func(days string) {
+		t.Helper()
+		data := `{
+			"version": 2,
+			"sources": [{"credentials": "` + creds + `", "token": "token.json", "calendars": [{"id": "primary"}]}],
+			"sinks": [{"token": "lifx", "light_id": "d073d5000001", "colors": {"busy": "red"}}],
+			"rules": {"days": ` + days + `}
+		}`
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("7")
+	running, err := configutil.Load(path, nil, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if err := running.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	m := &schedule.Manager{Settings: settings(running)}
+	before := m.Snapshot()
+
+	// An edit that doesn't validate keeps the running config and settings.
+	write("-1")
+	if got := reloadConfig(path, nil, running, m); got != running {
+		t.Errorf("invalid config: got %+v, want the running one", got)
+	}
+	if got := m.Snapshot(); !reflect.DeepEqual(got, before) {
+		t.Errorf("invalid config changed the settings to %+v", got)
+	}
+
+	// A valid one is swapped in.
+	write("3")
+	if got := reloadConfig(path, nil, running, m); got == running || got.Rules.Days != 3 {
+		t.Errorf("valid config: got %+v, want the new one", got)
+	}
+	if got := m.Snapshot().Days; got != 3 {
+		t.Errorf("Days after a valid edit: got %d, want 3", got)
+	}
+}
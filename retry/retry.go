@@ -0,0 +1,120 @@
+// Package retry runs calls again when they fail with errors worth retrying, waiting
+// an exponentially growing, jittered delay in between, or as long as the server asked.
+package retry
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Classifier decides whether an error is worth retrying, and how long the server
+// asked to wait first (e.g. with Retry-After), 0 if it didn't say.
+type Classifier func(err error) (retry bool, after time.Duration)
+
+// Policy says how often and how patiently a call is tried.
+type Policy struct {
+	// Attempts is how many times the call is tried in all, 3 if 0.
+	Attempts int
+	// Base and Max bound the backoff: the wait before retry n is a random duration
+	// up to min(Max, Base*2^n), so clients failing together don't retry together.
+	// They default to 500ms and 10s. Max also caps the wait a server asks for.
+	Base, Max time.Duration
+	// Classify picks the errors to retry, every error if nil.
+	Classify Classifier
+	// OnRetry, if set, is called before waiting to retry after a failed attempt.
+	OnRetry func(attempt int, wait time.Duration, err error)
+
+	// jitter returns a random duration in [0, d), rand.N if nil.
+	jitter func(d time.Duration) time.Duration
+}
+
+func (p Policy) max() time.Duration {
+	if p.Max > 0 {
+		return p.Max
+	}
+	return 10 * time.Second
+}
+
+func (p Policy) attempts() int {
+	if p.Attempts > 0 {
+		return p.Attempts
+	}
+	return 3
+}
+
+// backoff returns the wait before retrying after the attempt'th failure.
+func (p Policy) backoff(attempt int) time.Duration {
+	base, max := p.Base, p.max()
+	if base <= 0 {
+		base = 500 * time.Millisecond
+	}
+	d := max
+	if shift := attempt - 1; shift < 32 && base<<shift < max {
+		d = base << shift
+	}
+	if p.jitter != nil {
+		return p.jitter(d)
+	}
+	return rand.N(d)
+}
+
+// Do calls f until it succeeds, returns an error not worth retrying, or runs out
+// of attempts, and returns its last error. It gives up early with the context's
+// error when ctx is done while waiting.
+func (p Policy) Do(ctx context.Context, f func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := f(ctx)
+		if err == nil {
+			return nil
+		}
+		retry, after := true, time.Duration(0)
+		if p.Classify != nil {
+			retry, after = p.Classify(err)
+		}
+		if !retry || attempt >= p.attempts() {
+			return err
+		}
+		// A server may ask for longer than we're willing to hold up the caller.
+		wait := min(after, p.max())
+		if wait <= 0 {
+			wait = p.backoff(attempt)
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, wait, err)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Status reports whether an HTTP status code is worth retrying: 408 Request
+// Timeout, 429 Too Many Requests and the 5xx server errors.
+func Status(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500 && code <= 599
+}
+
+// ParseRetryAfter parses a Retry-After header, either seconds or an HTTP date,
+// into how long to wait from now. It returns 0 if the header is empty or invalid.
+func ParseRetryAfter(h string, now time.Time) time.Duration {
+	if h == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(h); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(h); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,152 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var errTemporary = errors.New("temporary")
+
+// fast is a policy that doesn't wait, recording the waits it would have.
+func fast(waits *[]time.Duration) Policy {
+	return Policy{
+		Base: time.Second, Max: 8 * time.Second,
+		jitter: func(d time.Duration) time.Duration { return 0 },
+		OnRetry: func(_ int, wait time.Duration, _ error) {
+			*waits = append(*waits, wait)
+		},
+	}
+}
+
+func TestDo(t *testing.T) {
+	var waits []time.Duration
+	calls := 0
+	err := fast(&waits).Do(context.Background(), func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errTemporary
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("got %v after %d calls, want success after 3", err, calls)
+	}
+	if len(waits) != 2 {
+		t.Errorf("retried %d times, want 2", len(waits))
+	}
+}
+
+func TestDo_GivesUp(t *testing.T) {
+	var waits []time.Duration
+	p := fast(&waits)
+	p.Attempts = 4
+	calls := 0
+	err := p.Do(context.Background(), func(context.Context) error {
+		calls++
+		return errTemporary
+	})
+	if !errors.Is(err, errTemporary) || calls != 4 {
+		t.Errorf("got %v after %d calls, want the last error after 4", err, calls)
+	}
+}
+
+func TestDo_Classify(t *testing.T) {
+	var waits []time.Duration
+	p := fast(&waits)
+	permanent := errors.New("bad request")
+	p.Classify = func(err error) (bool, time.Duration) {
+		if err == permanent {
+			return false, 0
+		}
+		return true, 3 * time.Millisecond
+	}
+	calls := 0
+	err := p.Do(context.Background(), func(context.Context) error {
+		calls++
+		if calls == 1 {
+			return errTemporary
+		}
+		return permanent
+	})
+	if err != permanent || calls != 2 {
+		t.Errorf("got %v after %d calls, want the permanent error after 2", err, calls)
+	}
+	if len(waits) != 1 || waits[0] != 3*time.Millisecond {
+		t.Errorf("waits: got %v, want the 3ms the server asked for", waits)
+	}
+}
+
+func TestDo_RetryAfterCapped(t *testing.T) {
+	var waits []time.Duration
+	p := fast(&waits)
+	p.Max = 5 * time.Millisecond
+	p.Classify = func(error) (bool, time.Duration) { return true, time.Hour }
+	calls := 0
+	err := p.Do(context.Background(), func(context.Context) error {
+		calls++
+		if calls == 1 {
+			return errTemporary
+		}
+		return nil
+	})
+	if err != nil || len(waits) != 1 || waits[0] != 5*time.Millisecond {
+		t.Errorf("got %v with waits %v, want the hour asked for capped to Max", err, waits)
+	}
+}
+
+func TestDo_Context(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := Policy{Base: time.Hour, Max: time.Hour, OnRetry: func(int, time.Duration, error) { cancel() }}
+	start := time.Now()
+	err := p.Do(ctx, func(context.Context) error { return errTemporary })
+	if !errors.Is(err, context.Canceled) || time.Since(start) > time.Second {
+		t.Errorf("got %v after %v, want context.Canceled right away", err, time.Since(start))
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := Policy{Base: time.Second, Max: 8 * time.Second, jitter: func(d time.Duration) time.Duration { return d }}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second}
+	for i, w := range want {
+		if got := p.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d): got %v, want %v", i+1, got, w)
+		}
+	}
+	p.jitter = nil
+	for i := 0; i < 100; i++ {
+		if d := p.backoff(3); d < 0 || d >= 4*time.Second {
+			t.Fatalf("jittered backoff(3): got %v, want [0, 4s)", d)
+		}
+	}
+	if d := (Policy{}).backoff(100); d < 0 || d >= 10*time.Second {
+		t.Errorf("default backoff(100): got %v, want under the 10s cap", d)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":     0,
+		"30":   30 * time.Second,
+		"-1":   0,
+		"soon": 0,
+		now.Add(time.Minute).Format(http.TimeFormat):  time.Minute,
+		now.Add(-time.Minute).Format(http.TimeFormat): 0,
+	}
+	for h, want := range tests {
+		if got := ParseRetryAfter(h, now); got != want {
+			t.Errorf("ParseRetryAfter(%q): got %v, want %v", h, got, want)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	for code, want := range map[int]bool{200: false, 400: false, 404: false, 408: true, 429: true, 500: true, 503: true} {
+		if got := Status(code); got != want {
+			t.Errorf("Status(%d): got %v, want %v", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package schedule
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Transition is a state change the Executor acts on, along with its reasons and
+// the colors the sinks show for it.
+type Transition struct {
+	Time       time.Time         `json:"time"`
+	State      State             `json:"state"`
+	Brightness float64           `json:"brightness,omitempty"`
+	Calendars  []string          `json:"calendars,omitempty"`
+	People     []string          `json:"people,omitempty"`
+	Colors     map[string]string `json:"colors,omitempty"` // by sink label, or ID when it has none
+}
+
+// Transitions returns the state at from followed by every change before to,
+// the same changes the Executor would push as the time passes.
+func (m *Manager) Transitions(from, to time.Time) []Transition {
+	times := []time.Time{from}
+	m.RLock()
+	for _, b := range m.current.Intervals {
+		for _, t := range []time.Time{b.Start, b.End} {
+			if t.After(from) && t.Before(to) {
+				times = append(times, t)
+			}
+		}
+	}
+	m.RUnlock()
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	var out []Transition
+	for _, t := range times {
+		// Blocks don't include their start, so look just past it
+		tr := m.transition(t, t.Add(time.Nanosecond))
+		if n := len(out); n > 0 && out[n-1].State == tr.State && out[n-1].Brightness == tr.Brightness {
+			continue
+		}
+		out = append(out, tr)
+	}
+	return out
+}
+
+// Describe returns the transition an action of the Executor makes.
+func (m *Manager) Describe(a Action) Transition {
+	return m.transition(a.Time, a.Time)
+}
+
+// transition returns the transition at t, looking the state up at at.
+func (m *Manager) transition(t, at time.Time) Transition {
+	state, cals, people := m.at(at)
+	colors := make(map[string]string)
+	for _, s := range m.Snapshot().Sinks {
+		colors[s.name()] = s.Color(state)
+	}
+	return Transition{Time: t, State: state, Brightness: m.Brightness(at), Calendars: cals, People: people, Colors: colors}
+}
+
+// WriteAgenda writes the transitions as a day-by-day agenda in local time.
+func WriteAgenda(w io.Writer, ts []Transition) error {
+	day := ""
+	for _, t := range ts {
+		local := t.Time.Local()
+		if d := local.Format("Mon Jan 2"); d != day {
+			if day != "" {
+				fmt.Fprintln(w)
+			}
+			day = d
+			fmt.Fprintln(w, day)
+		}
+		state := string(t.State)
+		if t.Brightness > 0 {
+			state += fmt.Sprintf(" %.0f%%", t.Brightness*100)
+		}
+		line := fmt.Sprintf("  %s  %-8s  %-24s  %s", local.Format("15:04"), state, colorList(t.Colors), strings.Join(t.Calendars, ", "))
+		if len(t.People) > 0 {
+			line += " (" + strings.Join(t.People, ", ") + ")"
+		}
+		if _, err := fmt.Fprintln(w, strings.TrimRight(line, " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// colorList formats the colors of a transition, leaving out the sink name if there's only one.
+func colorList(colors map[string]string) string {
+	if len(colors) == 1 {
+		for _, c := range colors {
+			return c
+		}
+	}
+	names := make([]string, 0, len(colors))
+	for name := range colors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + ": " + colors[name]
+	}
+	return strings.Join(names, ", ")
+}
+
+// timelineSlot is the time one character of the timeline stands for.
+const timelineSlot = 15 * time.Minute
+
+// timelineMarks are the characters of the timeline by state, the stronger of two
+// states in a slot wins.
+var timelineMarks = map[State]struct {
+	mark byte
+	rank int
+}{
+	Free:    {'.', 1},
+	Team:    {'+', 2},
+	Busy:    {'#', 3},
+	Unknown: {'?', 4},
+	Error:   {'!', 5},
+}
+
+// WriteTimeline writes the transitions between from and to as a compact ASCII
+// timeline, one line per local day with a character per 15 minutes.
+func WriteTimeline(w io.Writer, ts []Transition, from, to time.Time) error {
+	const label = "Mon Jan 02  "
+	slots := int(24 * time.Hour / timelineSlot)
+	header := []byte(strings.Repeat(" ", len(label)+slots))
+	for h := 0; h < 24; h += 3 {
+		copy(header[len(label)+h*int(time.Hour/timelineSlot):], fmt.Sprint(h))
+	}
+	fmt.Fprintln(w, strings.TrimRight(string(header), " "))
+
+	from, to = from.Local(), to.Local()
+	for day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.Local); day.Before(to); day = day.AddDate(0, 0, 1) {
+		row := []byte(strings.Repeat(" ", slots))
+		for i := range row {
+			start := day.Add(time.Duration(i) * timelineSlot)
+			end := start.Add(timelineSlot)
+			if !end.After(from) || !start.Before(to) {
+				continue
+			}
+			if start.Before(from) {
+				start = from
+			}
+			row[i] = slotMark(ts, start, end)
+		}
+		if _, err := fmt.Fprintf(w, "%s%s\n", day.Format(label), strings.TrimRight(string(row), " ")); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "\n. free  + team  # busy  ? unknown  ! error")
+	return err
+}
+
+// slotMark returns the mark of the strongest state between start and end.
+func slotMark(ts []Transition, start, end time.Time) byte {
+	best := timelineMarks[Free]
+	for i, t := range ts {
+		// A transition lasts until the next one, count it if that overlaps the slot
+		if !t.Time.Before(end) {
+			break
+		}
+		if i == len(ts)-1 || ts[i+1].Time.After(start) {
+			if m, ok := timelineMarks[t.State]; ok && m.rank > best.rank {
+				best = m
+			}
+		}
+	}
+	return best.mark
+}
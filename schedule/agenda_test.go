@@ -0,0 +1,78 @@
+package schedule
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransitions(t *testing.T) {
+	from := time.Date(2026, 10, 19, 8, 0, 0, 0, time.Local)
+	at := func(h, m int) time.Time { return from.Add(time.Duration(h-8)*time.Hour + time.Duration(m)*time.Minute) }
+	m := &Manager{Settings: Settings{Sinks: []Sink{{LightLabel: "desk", BusyColor: "red"}}}}
+	m.Update(Schedule{Intervals: []TimeBlock{
+		{Start: at(9, 0), End: at(10, 0), Calendars: []string{"primary"}},
+		{Start: at(9, 30), End: at(11, 0), State: Team, Calendars: []string{"team"}},
+		// Touches the team block, so there's no free gap in between
+		{Start: at(11, 0), End: at(11, 30), Calendars: []string{"primary"}},
+		{Start: at(20, 0), End: at(21, 0), Calendars: []string{"late"}},
+	}})
+
+	got := m.Transitions(from, at(18, 0))
+	want := []struct {
+		time  time.Time
+		state State
+		cal   string
+	}{
+		{from, Free, ""},
+		{at(9, 0), Busy, "primary"},
+		{at(10, 0), Team, "team"},
+		{at(11, 0), Busy, "primary"},
+		{at(11, 30), Free, ""},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("transitions: got %+v, want %d", got, len(want))
+	}
+	for i, w := range want {
+		if !got[i].Time.Equal(w.time) || got[i].State != w.state || strings.Join(got[i].Calendars, ",") != w.cal {
+			t.Errorf("transition %d: got %v %v %v, want %v %v %v", i, got[i].Time, got[i].State, got[i].Calendars, w.time, w.state, w.cal)
+		}
+	}
+	if c := got[1].Colors["desk"]; c != "red" {
+		t.Errorf("busy color: got %q, want red", c)
+	}
+	if c := got[2].Colors["desk"]; c != "blue saturation:0.5" {
+		t.Errorf("team color: got %q, want the default", c)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteAgenda(&buf, got); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "Mon Oct 19\n") || !strings.Contains(buf.String(), "  09:00  busy      red") {
+		t.Errorf("unexpected agenda:\n%s", buf.String())
+	}
+}
+
+func TestWriteTimeline(t *testing.T) {
+	from := time.Date(2026, 10, 19, 8, 0, 0, 0, time.Local)
+	ts := []Transition{
+		{Time: from, State: Free},
+		// Shorter than a slot, but still shows up
+		{Time: from.Add(time.Hour), State: Busy},
+		{Time: from.Add(time.Hour + 5*time.Minute), State: Free},
+	}
+	var buf bytes.Buffer
+	if err := WriteTimeline(&buf, ts, from, from.Add(4*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if !strings.HasPrefix(lines[0], "            0           3           6") {
+		t.Errorf("header: got %q", lines[0])
+	}
+	want := "Mon Oct 19  " + strings.Repeat(" ", 32) + "...." + "#..." + "...." + "...."
+	if lines[1] != want {
+		t.Errorf("timeline:\n got %q\nwant %q", lines[1], want)
+	}
+}
@@ -0,0 +1,209 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"on-air/auth"
+	"on-air/secrets"
+)
+
+// Role decides how the events of a calendar count towards our state.
+type Role string
+
+const (
+	// RoleBusy counts every busy block on the calendar (the default).
+	RoleBusy Role = "busy"
+	// RoleAccepted only counts events we have accepted. It needs the events scope rather than free/busy.
+	RoleAccepted Role = "accepted"
+	// RoleTeam is a shared team calendar, its blocks put us in the Team state rather than Busy.
+	RoleTeam Role = "team"
+)
+
+// Calendar is a calendar to watch along with its policy.
+type Calendar struct {
+	ID   string
+	Role Role
+	// IgnoreFrom and IgnoreUntil are local "15:04" clock times between which the calendar is ignored.
+	// The window wraps past midnight when IgnoreUntil is before IgnoreFrom.
+	IgnoreFrom  string
+	IgnoreUntil string
+}
+
+// Person is someone whose calendars count towards the light, with their own OAuth token
+// or a service-account key.
+type Person struct {
+	Name      string
+	Auth      auth.Mode
+	CredsPath string
+	TokenPath string
+	// KeyPath and Subject are used with auth.ModeServiceAccount.
+	KeyPath   string
+	Subject   string
+	Calendars []Calendar
+	// Secrets is where the token, OAuth client and key are kept, private plain files if nil.
+	Secrets secrets.Store
+	// Watch is set when push notifications are on. Watching a calendar needs the
+	// events scope, whatever its role.
+	Watch bool
+}
+
+// Scopes returns the OAuth scopes the person's token needs.
+func (p Person) Scopes() []string {
+	if p.Watch {
+		return []string{FreeBusyScope, EventsScope}
+	}
+	return Scopes(p.Calendars)
+}
+
+// store returns where the person's secrets are kept.
+func (p Person) store() secrets.Store {
+	if p.Secrets == nil {
+		return secrets.FileStore{}
+	}
+	return p.Secrets
+}
+
+// client returns an HTTP client authenticated as the person.
+func (p Person) client(ctx context.Context, scopes ...string) (*http.Client, error) {
+	if p.Auth == auth.ModeServiceAccount {
+		return auth.ServiceAccountClient(ctx, p.store(), p.KeyPath, p.Subject, scopes...)
+	}
+	return auth.GetClient(ctx, p.store(), p.CredsPath, p.TokenPath, scopes...)
+}
+
+// Occupancy decides how the busy blocks of several people combine.
+type Occupancy string
+
+const (
+	// OccupancyAny makes us busy as soon as anyone is busy (the default).
+	OccupancyAny Occupancy = "any"
+	// OccupancyScaled also scales the busy brightness by the share of people who are busy.
+	OccupancyScaled Occupancy = "scaled"
+)
+
+// state returns the state a block from this calendar puts us in.
+func (c Calendar) state() State {
+	if c.Role == RoleTeam {
+		return Team
+	}
+	return Busy
+}
+
+// parseClock parses a "15:04" clock time into its hour and minute.
+func parseClock(s string) (hour, min int, err error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid clock time %q, want HH:MM", s)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// ignoreWindows returns the periods overlapping [from, to) during which the calendar is ignored.
+// The bounds are wall clock times, so they stay put on days the clocks change.
+func (c Calendar) ignoreWindows(from, to time.Time) ([]TimeBlock, error) {
+	if c.IgnoreFrom == "" && c.IgnoreUntil == "" {
+		return nil, nil
+	}
+	startHour, startMin, err := parseClock(c.IgnoreFrom)
+	if err != nil {
+		return nil, err
+	}
+	endHour, endMin, err := parseClock(c.IgnoreUntil)
+	if err != nil {
+		return nil, err
+	}
+	endDay := 0
+	if endHour*60+endMin <= startHour*60+startMin {
+		endDay = 1 // the window runs past midnight
+	}
+	from, to = from.Local(), to.Local()
+	var windows []TimeBlock
+	// Start a day early so a window wrapping past midnight into `from` is covered.
+	y, m, d := from.Date()
+	for day := d - 1; !time.Date(y, m, day, 0, 0, 0, 0, time.Local).After(to); day++ {
+		windows = append(windows, TimeBlock{
+			Start: time.Date(y, m, day, startHour, startMin, 0, 0, time.Local),
+			End:   time.Date(y, m, day+endDay, endHour, endMin, 0, 0, time.Local),
+		})
+	}
+	return windows, nil
+}
+
+// subtract removes the windows from the blocks, splitting blocks where needed.
+func subtract(blocks, windows []TimeBlock) []TimeBlock {
+	for _, w := range windows {
+		var out []TimeBlock
+		for _, b := range blocks {
+			if !w.Start.Before(b.End) || !b.Start.Before(w.End) {
+				out = append(out, b)
+				continue
+			}
+			if b.Start.Before(w.Start) {
+				head := b
+				head.End = w.Start
+				out = append(out, head)
+			}
+			if w.End.Before(b.End) {
+				tail := b
+				tail.Start = w.End
+				out = append(out, tail)
+			}
+		}
+		blocks = out
+	}
+	return blocks
+}
+
+// mergeBlocks merges overlapping or touching blocks of the same state and person.
+// The calendars of merged blocks are combined so we know where a block came from.
+func mergeBlocks(blocks []TimeBlock) []TimeBlock {
+	sorted := make([]TimeBlock, len(blocks))
+	copy(sorted, blocks)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].state() != sorted[j].state() {
+			return sorted[i].state() < sorted[j].state()
+		}
+		if sorted[i].Person != sorted[j].Person {
+			return sorted[i].Person < sorted[j].Person
+		}
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+
+	var merged []TimeBlock
+	for _, b := range sorted {
+		n := len(merged)
+		if n > 0 && merged[n-1].state() == b.state() && merged[n-1].Person == b.Person && !b.Start.After(merged[n-1].End) {
+			last := &merged[n-1]
+			if b.End.After(last.End) {
+				last.End = b.End
+			}
+			last.Calendars = union(last.Calendars, b.Calendars)
+			continue
+		}
+		b.Calendars = union(nil, b.Calendars)
+		merged = append(merged, b)
+	}
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Start.Before(merged[j].Start) })
+	return merged
+}
+
+// union appends the strings of b missing from a.
+func union(a, b []string) []string {
+	for _, s := range b {
+		found := false
+		for _, have := range a {
+			if have == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			a = append(a, s)
+		}
+	}
+	return a
+}
@@ -0,0 +1,203 @@
+package schedule
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"on-air/auth"
+)
+
+func TestMergeBlocks(t *testing.T) {
+	base := time.Date(2025, 8, 20, 10, 0, 0, 0, time.UTC)
+	blocks := []TimeBlock{
+		{Start: base.Add(30 * time.Minute), End: base.Add(90 * time.Minute), Calendars: []string{"b"}},
+		{Start: base, End: base.Add(time.Hour), Calendars: []string{"a"}},
+		{Start: base.Add(3 * time.Hour), End: base.Add(4 * time.Hour), Calendars: []string{"a"}},
+		{Start: base, End: base.Add(time.Hour), State: Team, Calendars: []string{"team"}},
+	}
+	got := mergeBlocks(blocks)
+	want := []TimeBlock{
+		{Start: base, End: base.Add(90 * time.Minute), Calendars: []string{"a", "b"}},
+		{Start: base, End: base.Add(time.Hour), State: Team, Calendars: []string{"team"}},
+		{Start: base.Add(3 * time.Hour), End: base.Add(4 * time.Hour), Calendars: []string{"a"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeBlocks:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestManagerStateAt(t *testing.T) {
+	m := &Manager{}
+	base := time.Date(2025, 8, 20, 10, 0, 0, 0, time.UTC)
+	m.Update(Schedule{Intervals: []TimeBlock{
+		{Start: base, End: base.Add(2 * time.Hour), State: Team, Calendars: []string{"team"}},
+		{Start: base.Add(time.Hour), End: base.Add(90 * time.Minute), Calendars: []string{"me"}},
+	}})
+
+	tests := []struct {
+		at        time.Time
+		state     State
+		calendars []string
+	}{
+		{base.Add(-time.Minute), Free, nil},
+		{base.Add(30 * time.Minute), Team, []string{"team"}},
+		{base.Add(75 * time.Minute), Busy, []string{"me"}},
+		{base.Add(100 * time.Minute), Team, []string{"team"}},
+	}
+	for _, tt := range tests {
+		state, cals := m.StateAt(tt.at)
+		if state != tt.state || !reflect.DeepEqual(cals, tt.calendars) {
+			t.Errorf("StateAt(%v) = %v %v, want %v %v", tt.at, state, cals, tt.state, tt.calendars)
+		}
+	}
+}
+
+func TestIgnoreWindows(t *testing.T) {
+	c := Calendar{ID: "work", IgnoreFrom: "18:00", IgnoreUntil: "09:00"}
+	day := time.Date(2025, 8, 20, 0, 0, 0, 0, time.Local)
+	blocks := []TimeBlock{
+		// Straddles the start of the evening window.
+		{Start: day.Add(17 * time.Hour), End: day.Add(19 * time.Hour)},
+		// Entirely overnight, dropped.
+		{Start: day.Add(22 * time.Hour), End: day.Add(23 * time.Hour)},
+		// Early morning meeting running into working hours.
+		{Start: day.Add(32 * time.Hour), End: day.Add(34 * time.Hour)},
+	}
+	windows, err := c.ignoreWindows(day, day.Add(48*time.Hour))
+	if err != nil {
+		t.Fatalf("ignoreWindows: %v", err)
+	}
+	got := subtract(blocks, windows)
+	want := []TimeBlock{
+		{Start: day.Add(17 * time.Hour), End: day.Add(18 * time.Hour)},
+		{Start: day.Add(33 * time.Hour), End: day.Add(34 * time.Hour)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("subtract:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestIgnoreWindows_DST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	defer func(l *time.Location) { time.Local = l }(time.Local)
+	time.Local = berlin
+
+	// Clocks go forward an hour at 02:00 on 29 March 2026, so the day is 23 hours long.
+	c := Calendar{ID: "work", IgnoreFrom: "18:00", IgnoreUntil: "09:00"}
+	at := func(d, h, m int) time.Time { return time.Date(2026, 3, d, h, m, 0, 0, berlin) }
+	blocks := []TimeBlock{
+		// Right after the overnight window ends, counted.
+		{Start: at(29, 9, 0), End: at(29, 9, 30)},
+		// Right after the evening window starts, ignored.
+		{Start: at(29, 18, 0), End: at(29, 18, 30)},
+	}
+	windows, err := c.ignoreWindows(at(29, 0, 0), at(30, 0, 0))
+	if err != nil {
+		t.Fatalf("ignoreWindows: %v", err)
+	}
+	got := subtract(blocks, windows)
+	want := []TimeBlock{{Start: at(29, 9, 0), End: at(29, 9, 30)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("subtract on a DST day:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestIgnoreWindows_InvalidClock(t *testing.T) {
+	c := Calendar{ID: "work", IgnoreFrom: "6pm", IgnoreUntil: "09:00"}
+	if _, err := c.ignoreWindows(time.Now(), time.Now().Add(time.Hour)); err == nil {
+		t.Error("expected error for invalid clock time, got nil")
+	}
+}
+
+func TestMergeBlocks_KeepsPeopleApart(t *testing.T) {
+	base := time.Date(2025, 8, 20, 10, 0, 0, 0, time.UTC)
+	got := mergeBlocks([]TimeBlock{
+		{Start: base, End: base.Add(time.Hour), Person: "alice"},
+		{Start: base.Add(30 * time.Minute), End: base.Add(90 * time.Minute), Person: "bob"},
+		{Start: base.Add(time.Hour), End: base.Add(2 * time.Hour), Person: "alice"},
+	})
+	if len(got) != 2 {
+		t.Fatalf("expected 2 blocks, got %d: %+v", len(got), got)
+	}
+	if got[0].Person != "alice" || !got[0].End.Equal(base.Add(2*time.Hour)) {
+		t.Errorf("alice's blocks not merged: %+v", got[0])
+	}
+}
+
+func TestManagerBrightness(t *testing.T) {
+	base := time.Date(2025, 8, 20, 10, 0, 0, 0, time.UTC)
+	m := &Manager{Settings: Settings{
+		People:    []Person{{Name: "alice"}, {Name: "bob"}, {Name: "carol"}, {Name: "dave"}},
+		Occupancy: OccupancyScaled,
+	}}
+	m.Update(Schedule{Intervals: []TimeBlock{
+		{Start: base, End: base.Add(time.Hour), Person: "alice"},
+		{Start: base.Add(30 * time.Minute), End: base.Add(time.Hour), Person: "bob"},
+	}})
+
+	if got := m.Brightness(base.Add(15 * time.Minute)); got != 0.25 {
+		t.Errorf("one of four busy: got brightness %v, want 0.25", got)
+	}
+	if got := m.Brightness(base.Add(45 * time.Minute)); got != 0.5 {
+		t.Errorf("two of four busy: got brightness %v, want 0.5", got)
+	}
+	if got := m.Brightness(base.Add(2 * time.Hour)); got != 0 {
+		t.Errorf("nobody busy: got brightness %v, want 0", got)
+	}
+	status := m.Status(base.Add(45 * time.Minute))
+	if !reflect.DeepEqual(status.People, []string{"alice", "bob"}) {
+		t.Errorf("Status.People: got %v, want [alice bob]", status.People)
+	}
+
+	m.Reconfigure(Settings{People: m.People, Occupancy: OccupancyAny})
+	if got := m.Brightness(base.Add(45 * time.Minute)); got != 0 {
+		t.Errorf("any occupancy: got brightness %v, want 0", got)
+	}
+}
+
+// pathStore records the paths read from it and has nothing in them.
+type pathStore struct{ loaded []string }
+
+func (s *pathStore) Load(path string) ([]byte, error) {
+	s.loaded = append(s.loaded, path)
+	return nil, os.ErrNotExist
+}
+
+func (s *pathStore) Save(string, []byte) error { return nil }
+
+func TestPersonClient_UsesSecrets(t *testing.T) {
+	store := &pathStore{}
+	p := Person{CredsPath: "credentials.json", TokenPath: "token.json", Secrets: store}
+	if _, err := p.client(context.Background()); err == nil {
+		t.Fatal("expected an error from the empty store")
+	}
+	if !reflect.DeepEqual(store.loaded, []string{"credentials.json"}) {
+		t.Errorf("loaded %v from the person's store, want the credentials", store.loaded)
+	}
+
+	store = &pathStore{}
+	p = Person{Auth: auth.ModeServiceAccount, KeyPath: "key.json", Secrets: store}
+	if _, err := p.client(context.Background()); err == nil {
+		t.Fatal("expected an error from the empty store")
+	}
+	if !reflect.DeepEqual(store.loaded, []string{"key.json"}) {
+		t.Errorf("loaded %v from the person's store, want the key", store.loaded)
+	}
+}
+
+func TestPersonScopes(t *testing.T) {
+	busy := Person{Calendars: []Calendar{{ID: "primary"}}}
+	if got := busy.Scopes(); !reflect.DeepEqual(got, []string{FreeBusyScope}) {
+		t.Errorf("busy calendar: got %v, want only free/busy", got)
+	}
+	busy.Watch = true
+	if got := busy.Scopes(); !reflect.DeepEqual(got, []string{FreeBusyScope, EventsScope}) {
+		t.Errorf("watched busy calendar: got %v, want the events scope too", got)
+	}
+}
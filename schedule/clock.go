@@ -0,0 +1,65 @@
+package schedule
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the time the Executor runs on.
+type Clock interface {
+	Now() time.Time
+	// After waits for d to pass and then sends the time on the returned channel.
+	After(d time.Duration) <-chan time.Time
+}
+
+// wallClock is the real time.
+type wallClock struct{}
+
+func (wallClock) Now() time.Time                         { return time.Now() }
+func (wallClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// VirtualClock runs from one time to another, Speed times faster than the wall
+// clock. Time only moves when After is called, so everything reading it sees the
+// same steps whatever the speed. Once the end is reached After never fires and Done is closed.
+type VirtualClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	end   time.Time
+	speed float64
+	done  chan struct{}
+	once  sync.Once
+}
+
+// NewVirtualClock returns a clock at from that runs until to. A speed of 0 runs
+// as fast as possible.
+func NewVirtualClock(from, to time.Time, speed float64) *VirtualClock {
+	return &VirtualClock{now: from, end: to, speed: speed, done: make(chan struct{})}
+}
+
+func (c *VirtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *VirtualClock) After(d time.Duration) <-chan time.Time {
+	if c.speed > 0 {
+		time.Sleep(time.Duration(float64(d) / c.speed))
+	}
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	now := c.now
+	c.mu.Unlock()
+	if !now.Before(c.end) {
+		c.once.Do(func() { close(c.done) })
+		return nil // blocks forever
+	}
+	ch := make(chan time.Time, 1)
+	ch <- now
+	return ch
+}
+
+// Done is closed once the clock reaches its end.
+func (c *VirtualClock) Done() <-chan struct{} {
+	return c.done
+}
@@ -0,0 +1,46 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExecutorOnVirtualClock(t *testing.T) {
+	from := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	to := from.Add(4 * time.Hour)
+	clock := NewVirtualClock(from, to, 0)
+	m := &Manager{Clock: clock}
+	m.Update(Schedule{Intervals: []TimeBlock{
+		{Start: from.Add(time.Hour), End: from.Add(2 * time.Hour)},
+	}})
+
+	ch := make(chan Action)
+	go Executor(m, ch)
+	var got []Action
+	for done := false; !done; {
+		select {
+		case a := <-ch:
+			got = append(got, a)
+		case <-clock.Done():
+			done = true
+		}
+	}
+
+	// Blocks don't include their start, so the Executor sees them a tick later
+	want := []Action{
+		{State: Free, Time: from},
+		{State: Busy, Time: from.Add(time.Hour + time.Second)},
+		{State: Free, Time: from.Add(2 * time.Hour)},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("actions: got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].State != want[i].State || !got[i].Time.Equal(want[i].Time) {
+			t.Errorf("action %d: got %v at %v, want %v at %v", i, got[i].State, got[i].Time, want[i].State, want[i].Time)
+		}
+	}
+	if now := clock.Now(); !now.Equal(to) {
+		t.Errorf("clock stopped at %v, want %v", now, to)
+	}
+}
@@ -0,0 +1,109 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+
+	"on-air/calendarutil"
+	"on-air/metrics"
+)
+
+// syncHorizon is how far past the schedule window a full sync reads, so the
+// window can move on for a while before the cache runs out.
+const syncHorizon = 7 * 24 * time.Hour
+
+// calendarKey identifies a calendar of a person.
+type calendarKey struct {
+	person string
+	calID  string
+}
+
+// eventCache holds the events of a calendar between from and until, kept up to
+// date with the changes since the sync token.
+type eventCache struct {
+	token       string
+	from, until time.Time
+	events      map[string]*calendar.Event // by event ID
+}
+
+// covers reports whether the cache can answer for the window between now and to.
+func (c *eventCache) covers(now, to time.Time) bool {
+	return c != nil && c.token != "" && !now.Before(c.from) && !to.After(c.until)
+}
+
+// apply patches the cache with changed events, dropping the cancelled ones.
+func (c *eventCache) apply(events []*calendar.Event) {
+	for _, ev := range events {
+		if ev.Status == "cancelled" {
+			delete(c.events, ev.Id)
+			continue
+		}
+		c.events[ev.Id] = ev
+	}
+}
+
+// syncEvents returns the accepted events of a calendar, fetching only the changes
+// since the last call when it can. The whole range is read again when there's no
+// sync token yet, Google expired it, or the window moved past the cached range.
+func (m *Manager) syncEvents(ctx context.Context, log *slog.Logger, svc *calendar.Service, key calendarKey, now, to time.Time) ([]*calendar.Event, error) {
+	m.cacheMu.Lock()
+	defer m.cacheMu.Unlock()
+	if m.events == nil {
+		m.events = make(map[calendarKey]*eventCache)
+	}
+
+	c := m.events[key]
+	if c.covers(now, to) {
+		var changes []*calendar.Event
+		var next string
+		err := calendarRetry(log, "event sync").Do(ctx, func(ctx context.Context) error {
+			var err error
+			changes, next, err = calendarutil.SyncEvents(ctx, log, svc, key.calID, c.token, "", "")
+			return err
+		})
+		switch {
+		case errors.Is(err, calendarutil.ErrFullSyncRequired):
+			log.Info("sync token expired, reading the calendar again", "calendar", key.calID)
+			c = nil
+		case err != nil:
+			return nil, err
+		default:
+			metrics.EventSyncs.WithLabelValues("incremental").Inc()
+			c.apply(changes)
+			c.token = next
+		}
+	} else {
+		c = nil
+	}
+
+	if c == nil {
+		until := to.Add(syncHorizon)
+		var events []*calendar.Event
+		var next string
+		err := calendarRetry(log, "event sync").Do(ctx, func(ctx context.Context) error {
+			var err error
+			events, next, err = calendarutil.SyncEvents(ctx, log, svc, key.calID, "", now.Format(time.RFC3339), until.Format(time.RFC3339))
+			return err
+		})
+		if err != nil {
+			delete(m.events, key)
+			return nil, err
+		}
+		metrics.EventSyncs.WithLabelValues("full").Inc()
+		c = &eventCache{token: next, from: now, until: until, events: make(map[string]*calendar.Event)}
+		c.apply(events)
+		m.events[key] = c
+	}
+
+	var accepted []*calendar.Event
+	for _, ev := range c.events {
+		if calendarutil.Accepted(ev) {
+			accepted = append(accepted, ev)
+		}
+	}
+	return accepted, nil
+}
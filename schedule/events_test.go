@@ -0,0 +1,126 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+
+	"on-air/retry"
+)
+
+// fakeSync serves events.list with sync tokens: a full list ending with "t1",
+// the changes since "t1" ending with "t2", and 410 Gone for "t2". It counts the
+// full and incremental requests. The first fail requests get 503 instead.
+type fakeSync struct {
+	full, incremental int
+	fail              int
+}
+
+func (f *fakeSync) service(t *testing.T, at time.Time) *calendar.Service {
+	t.Helper()
+	event := func(id, status string) map[string]interface{} {
+		return map[string]interface{}{
+			"id": id, "status": status,
+			"start": map[string]string{"dateTime": at.Format(time.RFC3339)},
+			"end":   map[string]string{"dateTime": at.Add(time.Hour).Format(time.RFC3339)},
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if f.fail > 0 {
+			f.fail--
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": 503, "message": "Backend Error"}})
+			return
+		}
+		switch r.URL.Query().Get("syncToken") {
+		case "":
+			f.full++
+			body = map[string]interface{}{"items": []interface{}{event("a", "confirmed"), event("b", "confirmed")}, "nextSyncToken": "t1"}
+		case "t1":
+			f.incremental++
+			body = map[string]interface{}{"items": []interface{}{event("b", "cancelled"), event("c", "confirmed")}, "nextSyncToken": "t2"}
+		default:
+			w.WriteHeader(http.StatusGone)
+			body = map[string]interface{}{"error": map[string]interface{}{"code": 410, "message": "Sync token is no longer valid"}}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(srv.Close)
+	svc, err := calendar.NewService(context.Background(), option.WithEndpoint(srv.URL+"/"), option.WithHTTPClient(srv.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func eventIDs(events []*calendar.Event) []string {
+	var ids []string
+	for _, ev := range events {
+		ids = append(ids, ev.Id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestSyncEvents(t *testing.T) {
+	now := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	to := now.Add(7 * 24 * time.Hour)
+	f := &fakeSync{}
+	svc := f.service(t, now.Add(time.Hour))
+	m := &Manager{}
+	key := calendarKey{calID: "primary"}
+	sync := func(now, to time.Time) []string {
+		t.Helper()
+		events, err := m.syncEvents(context.Background(), slog.Default(), svc, key, now, to)
+		if err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+		return eventIDs(events)
+	}
+
+	if got := sync(now, to); len(got) != 2 || f.full != 1 {
+		t.Fatalf("first sync: got %v after %d full reads, want a and b after one", got, f.full)
+	}
+	if got := sync(now.Add(time.Minute), to.Add(time.Minute)); len(got) != 2 || got[0] != "a" || got[1] != "c" || f.incremental != 1 {
+		t.Fatalf("incremental sync: got %v after %d incremental reads, want a and c after one", got, f.incremental)
+	}
+	// Google expired t2, so everything is read again.
+	if got := sync(now.Add(2*time.Minute), to.Add(2*time.Minute)); len(got) != 2 || got[1] != "b" || f.full != 2 {
+		t.Fatalf("after 410: got %v after %d full reads, want a and b after two", got, f.full)
+	}
+	// The window moved past what the full read covered.
+	sync(now.Add(8*24*time.Hour), to.Add(8*24*time.Hour))
+	if f.full != 3 {
+		t.Errorf("window past the cache: %d full reads, want 3", f.full)
+	}
+}
+
+func TestSyncEvents_Retry(t *testing.T) {
+	defer func(p retry.Policy) { calendarBackoff = p }(calendarBackoff)
+	calendarBackoff.Base, calendarBackoff.Max = time.Millisecond, time.Millisecond
+
+	now := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	f := &fakeSync{fail: 2}
+	svc := f.service(t, now.Add(time.Hour))
+	m := &Manager{}
+	events, err := m.syncEvents(context.Background(), slog.Default(), svc, calendarKey{calID: "primary"}, now, now.Add(24*time.Hour))
+	if err != nil || len(events) != 2 {
+		t.Fatalf("got %d events, %v, want 2 after two retries", len(events), err)
+	}
+
+	f.fail = 3
+	if _, err := m.syncEvents(context.Background(), slog.Default(), svc, calendarKey{calID: "other"}, now, now.Add(24*time.Hour)); err == nil {
+		t.Error("got no error after three 503s, want the last one")
+	}
+}
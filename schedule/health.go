@@ -0,0 +1,115 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+)
+
+// Health states, as reported by Health.
+const (
+	Healthy  = "ok"
+	Starting = "starting"
+	Degraded = "degraded"
+)
+
+// health is when the manager last got something done.
+type health struct {
+	started  time.Time // first schedule load
+	synced   time.Time // last schedule load where every calendar loaded
+	lit      time.Time // last light command that reached every sink
+	lightErr error     // error of the last light command, nil if it succeeded
+}
+
+// Health is how a running manager is doing, served on /healthz and /readyz.
+type Health struct {
+	Status string `json:"status"` // Healthy, Starting or Degraded
+	// Ready is set once the calendars were synced and the lights set at least once.
+	Ready     bool       `json:"ready"`
+	LastSync  *time.Time `json:"last_sync,omitempty"`
+	LastLight *time.Time `json:"last_light_command,omitempty"`
+	// Problems says why the status is Degraded.
+	Problems []string `json:"problems,omitempty"`
+}
+
+// staleAfter returns how old the last sync or light command may get, three
+// reload intervals if StaleAfterSeconds is 0.
+func (s Settings) staleAfter() time.Duration {
+	if s.StaleAfterSeconds > 0 {
+		return time.Duration(s.StaleAfterSeconds) * time.Second
+	}
+	return 3 * s.reloadInterval()
+}
+
+// starting records the first schedule load, which the staleness of a manager
+// that never synced is measured from.
+func (m *Manager) starting(t time.Time) {
+	m.Lock()
+	defer m.Unlock()
+	if m.health.started.IsZero() {
+		m.health.started = t
+	}
+}
+
+// synced records a schedule load where every calendar loaded.
+func (m *Manager) synced(t time.Time) {
+	m.Lock()
+	defer m.Unlock()
+	m.health.synced = t
+}
+
+// commanded records the result of a light command.
+func (m *Manager) commanded(t time.Time, err error) {
+	m.Lock()
+	defer m.Unlock()
+	m.health.lightErr = err
+	if err == nil {
+		m.health.lit = t
+	}
+}
+
+// Health reports whether the calendars were synced and the lights commanded
+// recently enough at now. The lights only go stale while commands fail, since
+// they're left alone for hours when the state doesn't change.
+func (m *Manager) Health(now time.Time) Health {
+	m.RLock()
+	h := m.health
+	m.RUnlock()
+	staleAfter := m.Snapshot().staleAfter()
+
+	var out Health
+	since := func(t time.Time) time.Time {
+		if t.IsZero() {
+			return h.started
+		}
+		return t
+	}
+	if !h.synced.IsZero() {
+		out.LastSync = &h.synced
+	}
+	if !h.lit.IsZero() {
+		out.LastLight = &h.lit
+	}
+	out.Ready = out.LastSync != nil && out.LastLight != nil
+
+	if h.started.IsZero() {
+		out.Status = Starting
+		return out
+	}
+	if age := now.Sub(since(h.synced)); age > staleAfter {
+		out.Problems = append(out.Problems, fmt.Sprintf("calendars not synced for %s", age.Round(time.Second)))
+	}
+	if h.lightErr != nil {
+		if age := now.Sub(since(h.lit)); age > staleAfter {
+			out.Problems = append(out.Problems, fmt.Sprintf("lights failing for %s: %v", age.Round(time.Second), h.lightErr))
+		}
+	}
+	switch {
+	case len(out.Problems) > 0:
+		out.Status = Degraded
+	case !out.Ready:
+		out.Status = Starting
+	default:
+		out.Status = Healthy
+	}
+	return out
+}
@@ -0,0 +1,52 @@
+package schedule
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	start := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	m := &Manager{Settings: Settings{ReloadIntervalSeconds: 60}}
+
+	if h := m.Health(start); h.Status != Starting || h.Ready {
+		t.Errorf("before the first load: got %+v, want starting and not ready", h)
+	}
+
+	m.starting(start)
+	if h := m.Health(start.Add(time.Minute)); h.Status != Starting {
+		t.Errorf("loading: got %q, want starting", h.Status)
+	}
+	if h := m.Health(start.Add(4 * time.Minute)); h.Status != Degraded || len(h.Problems) != 1 {
+		t.Errorf("never synced: got %+v, want degraded", h)
+	}
+
+	m.synced(start.Add(time.Minute))
+	m.commanded(start.Add(time.Minute), nil)
+	if h := m.Health(start.Add(2 * time.Minute)); h.Status != Healthy || !h.Ready {
+		t.Errorf("synced: got %+v, want ok and ready", h)
+	}
+	// Lights that aren't touched for hours are fine as long as the last command worked.
+	m.synced(start.Add(5 * time.Hour))
+	if h := m.Health(start.Add(5 * time.Hour)); h.Status != Healthy {
+		t.Errorf("idle lights: got %+v, want ok", h)
+	}
+
+	m.commanded(start.Add(5*time.Hour), errors.New("lifx API error"))
+	if h := m.Health(start.Add(5 * time.Hour)); h.Status != Degraded {
+		t.Errorf("lights failing: got %+v, want degraded", h)
+	}
+	m.commanded(start.Add(5*time.Hour+time.Minute), nil)
+	if h := m.Health(start.Add(5*time.Hour + time.Minute)); h.Status != Healthy {
+		t.Errorf("lights recovered: got %+v, want ok", h)
+	}
+
+	m.Reconfigure(Settings{StaleAfterSeconds: 3600})
+	if h := m.Health(start.Add(5*time.Hour + 59*time.Minute)); h.Status != Healthy {
+		t.Errorf("stale_after_seconds 3600: got %+v, want ok", h)
+	}
+	if h := m.Health(start.Add(6*time.Hour + time.Minute)); h.Status != Degraded {
+		t.Errorf("stale_after_seconds 3600: got %+v, want degraded", h)
+	}
+}
@@ -2,52 +2,127 @@ package schedule
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"sync"
 	"time"
 
 	"google.golang.org/api/calendar/v3"
-	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 
 	"on-air/auth"
 	"on-air/calendarutil"
 	"on-air/lifxutil"
+	"on-air/logutil"
+	"on-air/metrics"
+	"on-air/retry"
 )
 
-const FreeBusyScope = "https://www.googleapis.com/auth/calendar.freebusy"
+const (
+	FreeBusyScope = "https://www.googleapis.com/auth/calendar.freebusy"
+	EventsScope   = "https://www.googleapis.com/auth/calendar.events.readonly"
+)
 
 type Schedule struct {
-	Intervals []TimeBlock
+	Intervals []TimeBlock `json:"intervals"`
 }
 
 type State string
 
 const (
-	Busy    State = "busy"
-	Free    State = "free"
+	Busy State = "busy"
+	Free State = "free"
+	Team State = "team"
+	// Unknown means the calendars couldn't be read for too many reloads in a row,
+	// so the last schedule we have can't be trusted any more.
 	Unknown State = "unknown"
+	// Error means we can't read the calendar until someone steps in, e.g. the OAuth grant was revoked.
+	Error State = "error"
 )
 
 type TimeBlock struct {
-	Start time.Time
-	End   time.Time
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// State is the state the block puts us in, Busy if empty.
+	State State `json:"state,omitempty"`
+	// Calendars are the calendars that contributed to the block.
+	Calendars []string `json:"calendars,omitempty"`
+	// Person is the name of the person whose calendars the block came from, empty outside shared-room mode.
+	Person string `json:"person,omitempty"`
 }
 
-type Manager struct {
-	sync.RWMutex
-	current               Schedule
-	CredsPath             string
-	TokenPath             string
-	CalID                 string
+func (b TimeBlock) state() State {
+	if b.State == "" {
+		return Busy
+	}
+	return b.State
+}
+
+// Status is a point-in-time view of the manager, as served on /status.
+type Status struct {
+	State     State     `json:"state"`
+	Calendars []string  `json:"calendars,omitempty"`
+	People    []string  `json:"people,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
+	// Lights is the virtual state of the lights in a dry run.
+	Lights []lifxutil.VirtualLight `json:"lights,omitempty"`
+}
+
+// Settings configure a Manager. They can be swapped while running with Reconfigure.
+type Settings struct {
+	// People are the calendar sources, a single unnamed one outside shared-room mode.
+	People                []Person
+	Sinks                 []Sink
+	Occupancy             Occupancy
 	Days                  int
-	LifxToken             string
-	LifxLightID           string
-	LifxLightLabel        string
-	LifxBusyColor         string
-	LifxFreeColor         string
 	ReloadIntervalSeconds int
+	// MaxReloadFailures is how many reloads in a row may fail before the last good
+	// schedule is dropped and the state is Unknown, 3 if 0.
+	MaxReloadFailures int
+	// StaleAfterSeconds is how old the last sync or light command may get before
+	// the manager is unhealthy, three reload intervals if 0.
+	StaleAfterSeconds int
+}
+
+type Manager struct {
+	sync.RWMutex
+	current    Schedule
+	fault      error // set while a person's OAuth grant is revoked
+	generation int   // bumped by Reconfigure so the Executor re-applies the state
+	reloadCh   chan struct{}
+	health     health         // when calendars were synced and lights commanded, see Health
+	failures   int            // reloads that failed in a row
+	stale      map[string]int // reloads in a row that failed for a person while others loaded
+	loadErr    error          // error of the last reload, nil if it succeeded
+	saved      SavedState
+	stateMu    sync.Mutex // serializes writes to the state file
+	cacheMu    sync.Mutex // guards events
+	events     map[calendarKey]*eventCache
+	Settings
+	// DryRun, when set, records the light calls instead of making them.
+	DryRun *lifxutil.Recorder
+	// Clock is the time the Executor runs on, the wall clock if nil.
+	Clock Clock
+	// Log is where the workers log, slog.Default() if nil.
+	Log *slog.Logger
+	// StatePath is the file the last schedule and light state are kept in between
+	// runs, see Restore. Nothing is saved if it's empty.
+	StatePath string
+}
+
+// logger returns the logger the workers log to.
+func (m *Manager) logger() *slog.Logger {
+	return logutil.Or(m.Log)
+}
+
+// clock returns the clock the Executor runs on.
+func (m *Manager) clock() Clock {
+	if m.Clock != nil {
+		return m.Clock
+	}
+	return wallClock{}
 }
 
 func (m *Manager) Update(s Schedule) {
@@ -56,6 +131,56 @@ func (m *Manager) Update(s Schedule) {
 	m.current = s
 }
 
+// Snapshot returns a copy of the current settings.
+func (m *Manager) Snapshot() Settings {
+	m.RLock()
+	defer m.RUnlock()
+	return m.Settings
+}
+
+// Reconfigure swaps in new settings. The schedule is reloaded right away and the
+// Executor re-applies the current state, so new calendars and colors take effect.
+func (m *Manager) Reconfigure(s Settings) {
+	m.Lock()
+	m.Settings = s
+	m.generation++
+	m.Unlock()
+	m.RequestReload()
+}
+
+// gen returns the settings generation.
+func (m *Manager) gen() int {
+	m.RLock()
+	defer m.RUnlock()
+	return m.generation
+}
+
+// RequestReload asks the Reloader to reload the schedule now rather than at the next tick.
+func (m *Manager) RequestReload() {
+	select {
+	case m.reloads() <- struct{}{}:
+	default:
+		// A reload is already pending
+	}
+}
+
+// reloads returns the channel reload requests are sent on.
+func (m *Manager) reloads() chan struct{} {
+	m.Lock()
+	defer m.Unlock()
+	if m.reloadCh == nil {
+		m.reloadCh = make(chan struct{}, 1)
+	}
+	return m.reloadCh
+}
+
+// setFault records the error that keeps us from reading calendars, nil once we can again.
+func (m *Manager) setFault(err error) {
+	m.Lock()
+	defer m.Unlock()
+	m.fault = err
+}
+
 func (m *Manager) InSchedule(t time.Time) bool {
 	m.RLock()
 	defer m.RUnlock()
@@ -67,98 +192,417 @@ func (m *Manager) InSchedule(t time.Time) bool {
 	return false
 }
 
-// LoadSchedule loads free/busy from GCal for now
-func (m *Manager) LoadSchedule() Schedule {
+// StateAt returns the state at t and the calendars responsible for it.
+// Busy wins over Team, and we're Free when no block covers t.
+// While a fault is recorded the state is Error whatever the schedule says.
+func (m *Manager) StateAt(t time.Time) (State, []string) {
+	state, cals, _ := m.at(t)
+	return state, cals
+}
+
+// at returns the state at t along with the calendars and people responsible for it.
+func (m *Manager) at(t time.Time) (State, []string, []string) {
+	m.RLock()
+	defer m.RUnlock()
+	if m.fault != nil {
+		return Error, nil, nil
+	}
+	if m.failures >= m.Settings.maxReloadFailures() {
+		return Unknown, nil, nil
+	}
+	state := Free
+	var cals, people []string
+	for _, block := range m.current.Intervals {
+		if !t.After(block.Start) || !t.Before(block.End) {
+			continue
+		}
+		var person []string
+		if block.Person != "" {
+			person = []string{block.Person}
+		}
+		switch block.state() {
+		case Busy:
+			if state != Busy {
+				state, cals, people = Busy, nil, nil
+			}
+			cals = union(cals, block.Calendars)
+			people = union(people, person)
+		case Team:
+			if state == Free {
+				state = Team
+			}
+			if state == Team {
+				cals = union(cals, block.Calendars)
+				people = union(people, person)
+			}
+		}
+	}
+	return state, cals, people
+}
+
+// Brightness returns the light brightness for the state at t, or 0 to leave it unchanged.
+// With scaled occupancy a busy light gets brighter the more people are busy.
+func (m *Manager) Brightness(t time.Time) float64 {
+	s := m.Snapshot()
+	if s.Occupancy != OccupancyScaled || len(s.People) == 0 {
+		return 0
+	}
+	state, _, people := m.at(t)
+	if state != Busy {
+		return 0
+	}
+	return float64(len(people)) / float64(len(s.People))
+}
+
+// Status returns the state at t for reporting.
+func (m *Manager) Status(t time.Time) Status {
+	state, cals, people := m.at(t)
+	status := Status{State: state, Calendars: cals, People: people, Time: t}
+	m.RLock()
+	defer m.RUnlock()
+	if m.fault != nil {
+		status.Error = m.fault.Error()
+	} else if m.loadErr != nil {
+		status.Error = m.loadErr.Error()
+	}
+	if m.DryRun != nil {
+		status.Lights = m.DryRun.Lights()
+	}
+	return status
+}
+
+// Person returns the person with the given name. The empty name returns the
+// only person when there is just one, named or not.
+func (m *Manager) Person(name string) (Person, error) {
+	people := m.Snapshot().People
+	for _, p := range people {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	if name == "" {
+		switch len(people) {
+		case 0:
+			return Person{}, errors.New("no sources are configured")
+		case 1:
+			return people[0], nil
+		}
+		return Person{}, errors.New("several people are configured, pick one")
+	}
+	return Person{}, fmt.Errorf("no person named %q", name)
+}
+
+// Scopes returns the OAuth scopes needed to read the given calendars.
+func Scopes(cals []Calendar) []string {
+	s := []string{FreeBusyScope}
+	for _, c := range cals {
+		if c.Role == RoleAccepted {
+			return append(s, EventsScope)
+		}
+	}
+	return s
+}
+
+// LoadSchedule loads free/busy from GCal for now. On error the schedule holds
+// the blocks of the people that did load.
+func (m *Manager) LoadSchedule() (Schedule, error) {
+	start := time.Now()
+	now := start.UTC()
+	m.starting(start)
+	s, err := m.LoadScheduleBetween(now, now.Add(time.Duration(m.Snapshot().Days)*24*time.Hour))
+	if err == nil {
+		m.synced(time.Now())
+		metrics.BusyBlocks.Set(float64(len(s.Intervals)))
+	}
+	metrics.Reloaded(err == nil, time.Since(start))
+	return s, err
+}
+
+// LoadScheduleBetween loads the schedule between now and to, which don't have to
+// be the current time, e.g. to simulate a past day. On error the schedule holds
+// the blocks of the people that did load.
+func (m *Manager) LoadScheduleBetween(now, to time.Time) (Schedule, error) {
 	ctx := context.Background()
+	settings := m.Snapshot()
+
+	var all []TimeBlock
+	var fault error
+	var errs []error
+	for _, p := range settings.People {
+		log := m.logger()
+		if p.Name != "" {
+			log = log.With("person", p.Name)
+		}
+		blocks, err := m.loadPerson(ctx, log, p, now, to)
+		if err != nil {
+			// Don't exit, just leave this person's blocks out of the schedule
+			err = &personError{person: p.Name, err: err}
+			if errors.Is(err, auth.ErrRevoked) || errors.Is(err, auth.ErrNoToken) {
+				fault = err
+			}
+			errs = append(errs, err)
+			continue
+		}
+		all = append(all, blocks...)
+	}
+	// In shared-room mode one person's grant shouldn't turn the whole room to
+	// Error, the others' calendars still say whether it's busy.
+	if len(errs) < len(settings.People) {
+		fault = nil
+	}
+	m.setFault(fault)
+	return Schedule{Intervals: mergeBlocks(all)}, errors.Join(errs...)
+}
+
+// personError is why a person's calendars didn't load.
+type personError struct {
+	person string
+	err    error
+}
+
+func (e *personError) Error() string {
+	if e.person == "" {
+		return e.err.Error()
+	}
+	return e.person + ": " + e.err.Error()
+}
+
+func (e *personError) Unwrap() error { return e.err }
+
+// failedPeople returns the people whose calendars didn't load, as named in err.
+func failedPeople(err error) map[string]bool {
+	failed := map[string]bool{}
+	var errs []error
+	if j, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = j.Unwrap()
+	} else {
+		errs = []error{err}
+	}
+	for _, err := range errs {
+		var pe *personError
+		if errors.As(err, &pe) {
+			failed[pe.person] = true
+		}
+	}
+	return failed
+}
+
+// Reload loads the schedule and swaps it in, as a scheduled reload. When loading
+// fails the last good schedule is kept, until MaxReloadFailures scheduled reloads
+// in a row failed and the state turns Unknown. When only some people fail, the
+// others' fresh blocks are swapped in and the failed people's last good blocks
+// kept for as long.
+func (m *Manager) Reload() error {
+	return m.reload(true)
+}
+
+// reload is Reload. Only scheduled reloads count towards MaxReloadFailures, so
+// the reloads requested by config edits and push notifications don't turn the
+// lights Unknown any sooner during an outage.
+func (m *Manager) reload(scheduled bool) error {
+	s, err := m.LoadSchedule()
+	m.Lock()
+	if err != nil {
+		failed := failedPeople(err)
+		if len(failed) == 0 || len(failed) >= len(m.Settings.People) {
+			if scheduled {
+				m.failures++
+			}
+			m.loadErr = err
+			failures := m.failures
+			m.Unlock()
+			m.logger().Error("reload failed, keeping the last schedule", "failures", failures, logutil.Err(err))
+			return err
+		}
+		s = m.keepStale(s, failed, scheduled)
+		m.current = s
+		m.failures = 0
+		m.loadErr = err
+		m.Unlock()
+		m.logger().Error("reload failed for some people, keeping their last schedule", "blocks", len(s.Intervals), logutil.Err(err))
+		m.fetched(s, time.Now())
+		return err
+	}
+	m.current = s
+	m.failures = 0
+	m.stale = nil
+	m.loadErr = nil
+	m.Unlock()
+	m.logger().Info("schedule reloaded", "blocks", len(s.Intervals))
+	m.fetched(s, time.Now())
+	return nil
+}
+
+// keepStale adds the last good blocks of the failed people to s, until
+// MaxReloadFailures scheduled reloads in a row failed for them. Call with m locked.
+func (m *Manager) keepStale(s Schedule, failed map[string]bool, scheduled bool) Schedule {
+	stale := map[string]int{}
+	for person := range failed {
+		stale[person] = m.stale[person]
+		if scheduled {
+			stale[person]++
+		}
+	}
+	m.stale = stale
+	blocks := s.Intervals
+	for _, b := range m.current.Intervals {
+		if failed[b.Person] && stale[b.Person] < m.Settings.maxReloadFailures() {
+			blocks = append(blocks, b)
+		}
+	}
+	return Schedule{Intervals: mergeBlocks(blocks)}
+}
+
+// calendarBackoff is how Calendar API calls are retried. Tests shorten it.
+var calendarBackoff = retry.Policy{Attempts: 3, Base: time.Second, Max: 8 * time.Second, Classify: calendarutil.Retryable}
+
+// calendarRetry returns the retry policy for a Calendar API call, logging each retry.
+func calendarRetry(log *slog.Logger, what string) retry.Policy {
+	p := calendarBackoff
+	p.OnRetry = func(attempt int, wait time.Duration, err error) {
+		log.Warn(what+" failed, retrying", "attempt", attempt, "backoff", wait, logutil.Err(err))
+	}
+	return p
+}
 
-	client, err := auth.GetClient(ctx, m.CredsPath, m.TokenPath, FreeBusyScope)
+// loadPerson loads the blocks of all calendars of a person between now and to.
+func (m *Manager) loadPerson(ctx context.Context, log *slog.Logger, p Person, now, to time.Time) ([]TimeBlock, error) {
+	cals := p.Calendars
+	client, err := p.client(ctx, p.Scopes()...)
 	if err != nil {
-		log.Printf("auth client: %v", err)
-		return Schedule{} // Don't exit, just return empty schedule
+		return nil, fmt.Errorf("auth client: %w", err)
 	}
 	svc, err := calendar.NewService(ctx, option.WithHTTPClient(client))
 	if err != nil {
-		log.Printf("calendar service: %v", err)
-		return Schedule{} // Don't exit, just return empty schedule
-	}
-	now := time.Now().UTC()
-	to := now.Add(time.Duration(m.Days) * 24 * time.Hour)
-
-	var resp *calendar.FreeBusyResponse
-	var lastErr error
-	maxAttempts := 3
-	backoff := 1 * time.Second
-	maxBackoff := 8 * time.Second
-	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		resp, lastErr = calendarutil.QueryFreeBusy(
-			ctx,
-			svc,
-			m.CalID,
-			now.Format(time.RFC3339),
-			to.Format(time.RFC3339),
-		)
-		if lastErr == nil {
-			break
-		}
-		// Check for 500-level error
-		if apiErr, ok := lastErr.(*googleapi.Error); ok && apiErr.Code >= 500 && apiErr.Code <= 599 {
-			fmt.Printf("FreeBusy query attempt %d failed with 5xx error (%d): %v. Retrying in %v...\n", attempt, apiErr.Code, apiErr, backoff)
-			time.Sleep(backoff)
-			backoff *= 2
-			if backoff > maxBackoff {
-				backoff = maxBackoff
+		return nil, fmt.Errorf("calendar service: %w", err)
+	}
+
+	blocks := make(map[string][]TimeBlock)
+	var freeBusyIDs []string
+	for _, c := range cals {
+		if c.Role == RoleAccepted {
+			events, err := m.syncEvents(ctx, log, svc, calendarKey{p.Name, c.ID}, now, to)
+			if err != nil {
+				return nil, fmt.Errorf("list events for %s: %w", c.ID, err)
+			}
+			for _, ev := range events {
+				start, err := time.Parse(time.RFC3339, ev.Start.DateTime)
+				if err != nil {
+					log.Warn("parse start time", "calendar", c.ID, logutil.Err(err))
+					continue
+				}
+				end, err := time.Parse(time.RFC3339, ev.End.DateTime)
+				if err != nil {
+					log.Warn("parse end time", "calendar", c.ID, logutil.Err(err))
+					continue
+				}
+				if !end.After(now) || !start.Before(to) {
+					continue // cached for a later window
+				}
+				blocks[c.ID] = append(blocks[c.ID], TimeBlock{Start: start, End: end, State: c.state(), Calendars: []string{c.ID}, Person: p.Name})
 			}
 			continue
 		}
-		// Not a 5xx error, break and handle as usual
-		break
-	}
-	if lastErr != nil {
-		// The query failed for some reason
-		log.Printf("freebusy query: %v", lastErr)
-		// Return an empty schedule to just keep the system running
-		return Schedule{}
+		freeBusyIDs = append(freeBusyIDs, c.ID)
 	}
-	for id, cal := range resp.Calendars {
-		if len(cal.Busy) == 0 {
-			fmt.Printf("  %s: no busy blocks 🎉\n", id)
-			continue
+
+	if len(freeBusyIDs) > 0 {
+		var resp *calendar.FreeBusyResponse
+		policy := calendarRetry(log, "freebusy query")
+		onRetry := policy.OnRetry
+		policy.OnRetry = func(attempt int, wait time.Duration, err error) {
+			metrics.FreeBusyRetries.Inc()
+			onRetry(attempt, wait, err)
 		}
-		for _, b := range cal.Busy {
-			start, err := time.Parse(time.RFC3339, b.Start)
-			if err != nil {
-				log.Printf("parse start time: %v", err)
+		err := policy.Do(ctx, func(ctx context.Context) error {
+			var err error
+			resp, err = calendarutil.QueryFreeBusy(ctx, svc, freeBusyIDs, now.Format(time.RFC3339), to.Format(time.RFC3339))
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("freebusy query: %w", err)
+		}
+		for _, c := range cals {
+			if c.Role == RoleAccepted {
 				continue
 			}
-			end, err := time.Parse(time.RFC3339, b.End)
-			if err != nil {
-				log.Printf("parse end time: %v", err)
+			cal, ok := resp.Calendars[c.ID]
+			if !ok {
 				continue
 			}
-			return Schedule{
-				Intervals: []TimeBlock{
-					{Start: start, End: end},
-				},
+			if len(cal.Errors) > 0 {
+				return nil, fmt.Errorf("freebusy %s: %s", c.ID, cal.Errors[0].Reason)
 			}
+			if len(cal.Busy) == 0 {
+				log.Debug("no busy blocks", "calendar", c.ID)
+				continue
+			}
+			for _, b := range cal.Busy {
+				start, err := time.Parse(time.RFC3339, b.Start)
+				if err != nil {
+					log.Warn("parse start time", "calendar", c.ID, logutil.Err(err))
+					continue
+				}
+				end, err := time.Parse(time.RFC3339, b.End)
+				if err != nil {
+					log.Warn("parse end time", "calendar", c.ID, logutil.Err(err))
+					continue
+				}
+				blocks[c.ID] = append(blocks[c.ID], TimeBlock{Start: start, End: end, State: c.state(), Calendars: []string{c.ID}, Person: p.Name})
+			}
+		}
+	}
+
+	var all []TimeBlock
+	for _, c := range cals {
+		windows, err := c.ignoreWindows(now, to)
+		if err != nil {
+			log.Warn("ignore hours", "calendar", c.ID, logutil.Err(err))
 		}
+		all = append(all, subtract(blocks[c.ID], windows)...)
 	}
-	return Schedule{}
+	return all, nil
 }
 
-// Reloader Worker: reload schedule based on ReloadIntervalSeconds
+// maxReloadFailures returns how many reloads in a row may fail, 3 if MaxReloadFailures is 0.
+func (s Settings) maxReloadFailures() int {
+	if s.MaxReloadFailures > 0 {
+		return s.MaxReloadFailures
+	}
+	return 3
+}
+
+// reloadInterval returns the reload interval.
 // If ReloadIntervalSeconds is 0, it defaults to 60 seconds.
-func Reloader(m *Manager) {
-	interval := time.Duration(m.ReloadIntervalSeconds) * time.Second
+func (s Settings) reloadInterval() time.Duration {
+	interval := time.Duration(s.ReloadIntervalSeconds) * time.Second
 	if interval <= 0 {
 		interval = 60 * time.Second // fallback to 60 seconds if not set
 	}
+	return interval
+}
+
+// Reloader Worker: reload schedule based on ReloadIntervalSeconds,
+// or right away when a reload is requested. The caller does the first reload,
+// e.g. at startup.
+func Reloader(m *Manager) {
+	interval := m.Snapshot().reloadInterval()
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
+	reload := m.reloads()
 
 	for {
-		m.Update(m.LoadSchedule())
-		fmt.Println("Schedule reloaded")
-		<-ticker.C
+		scheduled := true
+		select {
+		case <-ticker.C:
+		case <-reload:
+			scheduled = false
+		}
+		_ = m.reload(scheduled) // logged by reload
+		if next := m.Snapshot().reloadInterval(); next != interval {
+			interval = next
+			ticker.Reset(interval)
+		}
 	}
 }
 
@@ -166,52 +610,91 @@ func Reloader(m *Manager) {
 type Action struct {
 	State State // "inside" or "outside"
 	Time  time.Time
+	// Brightness is the brightness to set between 0 and 1, 0 leaves it unchanged.
+	Brightness float64
 }
 
-// ActionWorker handles REST calls
-func ActionWorker(ch <-chan Action, lifxToken, lifxLightID, lifxLightLabel, lifxBusyColor, lifxFreeColor string) {
+// ActionWorker handles REST calls, styling every sink with the manager's current settings
+func ActionWorker(ch <-chan Action, m *Manager) {
+	last := m.shown()
+	if last == "" {
+		last = Unknown
+	}
 	for action := range ch {
-		lc := lifxutil.NewClient(lifxToken)
-		light := lifxutil.Light{ID: lifxLightID, Label: lifxLightLabel}
+		action = m.coalesce(ch, action)
+		if err := m.Apply(action, last); err != nil {
+			m.logger().Error("set lights", "state", action.State, logutil.Err(err))
+		} else {
+			m.logger().Info("set lights", "state", action.State)
+		}
+		last = action.State
+	}
+}
 
-		if action.State == Busy {
-			if err := lc.SetBusy(light, lifxBusyColor); err != nil {
-				fmt.Printf("Failed to set busy state: %v\n", err)
-				continue
+// coalesce holds light commands back while a sink's LIFX token is near its rate
+// limit. Only the latest state matters, so queued actions are dropped for the
+// last one, and with the budget spent newer ones are taken until it resets.
+func (m *Manager) coalesce(ch <-chan Action, action Action) Action {
+	low, wait := m.lightBudget(time.Now())
+	if !low {
+		return action
+	}
+	if wait > 0 {
+		m.logger().Info("lifx rate limit reached, holding light commands", "state", action.State, "wait", wait)
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case next, ok := <-ch:
+			if !ok {
+				return action
 			}
-			fmt.Printf("Set busy at %s\n", action.Time.Format(time.RFC3339))
-		} else if action.State == Free {
-			if err := lc.SetFree(light, lifxFreeColor); err != nil {
-				fmt.Printf("Failed to set free state: %v\n", err)
-				continue
+			metrics.CoalescedCommands.Inc()
+			action = next
+			continue
+		case <-timer.C:
+		}
+		// Take what's queued by now, then go.
+		for {
+			select {
+			case next, ok := <-ch:
+				if !ok {
+					return action
+				}
+				metrics.CoalescedCommands.Inc()
+				action = next
+			default:
+				return action
 			}
-			fmt.Printf("Set free at %s\n", action.Time.Format(time.RFC3339))
 		}
 	}
 }
 
 // Executor detect transitions and push to worker channel
 func Executor(m *Manager, ch chan<- Action) {
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
-
-	currentState := Unknown
+	clock := m.clock()
+	// The first state is always sent, even one restored from a state file, so the
+	// lights take the current sink styles and count as commanded.
+	var currentState State
+	currentBrightness := 0.0
+	currentGen := m.gen()
 
 	for {
-		now := time.Now()
-		inSchedule := m.InSchedule(now)
-
-		newState := Free
-		if inSchedule {
-			newState = Busy
-		}
+		now := clock.Now()
+		newState, _ := m.StateAt(now)
+		brightness := m.Brightness(now)
+		gen := m.gen()
 
-		// Only push events when state changes
-		if newState != currentState {
-			ch <- Action{State: newState, Time: now}
+		// Only push events when state changes, or the settings did so it's restyled
+		if newState != currentState || brightness != currentBrightness || gen != currentGen {
+			ch <- Action{State: newState, Time: now, Brightness: brightness}
+			metrics.SetState(string(newState))
 			currentState = newState
+			currentBrightness = brightness
+			currentGen = gen
 		}
 
-		<-ticker.C
+		<-clock.After(1 * time.Second)
 	}
 }
@@ -1,8 +1,13 @@
 package schedule
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"on-air/auth"
 )
 
 func TestManagerInSchedule(t *testing.T) {
@@ -50,3 +55,169 @@ func TestExecutorStateTransitions(t *testing.T) {
 		t.Errorf("unexpected state: %v", action.State)
 	}
 }
+
+func TestManagerFault(t *testing.T) {
+	m := &Manager{}
+	start := time.Now().Add(-time.Minute)
+	end := time.Now().Add(time.Minute)
+	m.Update(Schedule{Intervals: []TimeBlock{{Start: start, End: end}}})
+
+	m.setFault(auth.ErrRevoked)
+	if state, _ := m.StateAt(time.Now()); state != Error {
+		t.Errorf("expected error state while revoked, got %v", state)
+	}
+	if status := m.Status(time.Now()); status.Error == "" {
+		t.Error("expected status to report the error")
+	}
+
+	m.setFault(nil)
+	if state, _ := m.StateAt(time.Now()); state != Busy {
+		t.Errorf("expected busy state once cleared, got %v", state)
+	}
+}
+
+func TestManagerReload(t *testing.T) {
+	// The only person can't be read, so every reload fails.
+	m := &Manager{Settings: Settings{
+		People:            []Person{{CredsPath: "missing.json", TokenPath: "missing.json"}},
+		MaxReloadFailures: 2,
+	}}
+	start := time.Now().Add(-time.Minute)
+	end := time.Now().Add(time.Minute)
+	m.Update(Schedule{Intervals: []TimeBlock{{Start: start, End: end}}})
+
+	if err := m.Reload(); err == nil {
+		t.Fatal("expected the reload to fail")
+	}
+	if state, _ := m.StateAt(time.Now()); state != Busy {
+		t.Errorf("after one failure: got %v, want the last schedule's busy", state)
+	}
+	if status := m.Status(time.Now()); status.Error == "" {
+		t.Error("expected status to report the reload error")
+	}
+
+	// Requested reloads, e.g. after a config edit, don't count.
+	_ = m.reload(false)
+	_ = m.reload(false)
+	if state, _ := m.StateAt(time.Now()); state != Busy {
+		t.Errorf("after requested reloads failed: got %v, want the last schedule's busy", state)
+	}
+
+	_ = m.Reload()
+	if state, _ := m.StateAt(time.Now()); state != Unknown {
+		t.Errorf("after two failures: got %v, want unknown", state)
+	}
+
+	m.Reconfigure(Settings{})
+	if err := m.Reload(); err != nil {
+		t.Fatalf("reload without people: %v", err)
+	}
+	if state, _ := m.StateAt(time.Now()); state != Free {
+		t.Errorf("after a good reload: got %v, want free", state)
+	}
+	if status := m.Status(time.Now()); status.Error != "" {
+		t.Errorf("status error after a good reload: %q", status.Error)
+	}
+}
+
+func TestManagerReload_Partial(t *testing.T) {
+	// alice loads, with no calendars, and bob has no token.
+	dir := t.TempDir()
+	creds := filepath.Join(dir, "credentials.json")
+	token := filepath.Join(dir, "alice_token.json")
+	files := map[string]string{
+		creds: `{"installed":{"client_id":"id","client_secret":"secret","auth_uri":"https://accounts.google.com/o/oauth2/auth","token_uri":"https://oauth2.googleapis.com/token","redirect_uris":["http://localhost"]}}`,
+		token: `{"access_token":"x","token_type":"Bearer","expiry":"2999-01-01T00:00:00Z"}`,
+	}
+	for path, data := range files {
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := &Manager{Settings: Settings{
+		People: []Person{
+			{Name: "alice", CredsPath: creds, TokenPath: token},
+			{Name: "bob", CredsPath: creds, TokenPath: filepath.Join(dir, "bob_token.json")},
+		},
+		MaxReloadFailures: 2,
+	}}
+	now := time.Now()
+	m.Update(Schedule{Intervals: []TimeBlock{
+		{Start: now.Add(-time.Minute), End: now.Add(time.Minute), Person: "alice"},
+		{Start: now.Add(time.Hour), End: now.Add(2 * time.Hour), Person: "bob"},
+	}})
+
+	if err := m.Reload(); err == nil {
+		t.Fatal("expected the reload to fail for bob")
+	}
+	// alice's fresh, empty schedule replaces her block, bob's last one is kept,
+	// and his missing token doesn't turn the room to Error.
+	if state, _ := m.StateAt(now); state != Free {
+		t.Errorf("now: got %v, want alice's fresh free", state)
+	}
+	if state, _ := m.StateAt(now.Add(90 * time.Minute)); state != Busy {
+		t.Errorf("later: got %v, want bob's last busy", state)
+	}
+	if status := m.Status(now); !strings.Contains(status.Error, "bob") {
+		t.Errorf("status error: got %q, want bob's", status.Error)
+	}
+
+	// After MaxReloadFailures scheduled reloads bob's stale blocks are dropped,
+	// and the room doesn't go Unknown.
+	_ = m.Reload()
+	if state, _ := m.StateAt(now.Add(90 * time.Minute)); state != Free {
+		t.Errorf("after two failures: got %v, want free", state)
+	}
+}
+
+func TestExecutorReappliesStateOnReconfigure(t *testing.T) {
+	m := &Manager{Settings: Settings{Sinks: []Sink{{BusyColor: "red"}}}}
+	ch := make(chan Action, 10)
+	start := time.Now().Add(-time.Minute)
+	end := time.Now().Add(time.Minute)
+	m.Update(Schedule{Intervals: []TimeBlock{{Start: start, End: end}}})
+
+	go Executor(m, ch)
+	if action := <-ch; action.State != Busy {
+		t.Fatalf("unexpected state: %v", action.State)
+	}
+
+	m.Reconfigure(Settings{Sinks: []Sink{{BusyColor: "blue"}}})
+	select {
+	case action := <-ch:
+		if action.State != Busy {
+			t.Errorf("unexpected state after reconfigure: %v", action.State)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("state not re-applied after reconfigure")
+	}
+	if got := m.Snapshot().Sinks[0].BusyColor; got != "blue" {
+		t.Errorf("BusyColor: got %v, want blue", got)
+	}
+	select {
+	case <-m.reloads():
+	default:
+		t.Error("expected a schedule reload to be requested")
+	}
+}
+
+func TestManagerPerson(t *testing.T) {
+	one := &Manager{Settings: Settings{People: []Person{{Name: "alice"}}}}
+	if p, err := one.Person(""); err != nil || p.Name != "alice" {
+		t.Errorf("only source, no name: got %+v, %v, want alice", p, err)
+	}
+	if p, err := one.Person("alice"); err != nil || p.Name != "alice" {
+		t.Errorf("by name: got %+v, %v, want alice", p, err)
+	}
+	if _, err := one.Person("bob"); err == nil {
+		t.Error("unknown name: expected an error")
+	}
+
+	two := &Manager{Settings: Settings{People: []Person{{Name: "alice"}, {Name: "bob"}}}}
+	if _, err := two.Person(""); err == nil {
+		t.Error("several people, no name: expected an error")
+	}
+	if _, err := (&Manager{}).Person(""); err == nil {
+		t.Error("no sources: expected an error")
+	}
+}
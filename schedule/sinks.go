@@ -0,0 +1,155 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"on-air/lifxutil"
+	"on-air/logutil"
+	"on-air/metrics"
+)
+
+// Sink is a light the state is shown on, with its own colors. Empty colors use
+// the lifxutil defaults.
+type Sink struct {
+	Type       string // "lifx", the only kind so far
+	Token      string
+	LightID    string
+	LightLabel string
+	BusyColor  string
+	FreeColor  string
+	TeamColor  string
+	ErrorColor string
+	// UnknownColor is shown once the calendars couldn't be read for too long.
+	UnknownColor string
+}
+
+// LogValue logs the sink without its token.
+func (s Sink) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("type", or(s.Type, "lifx")), slog.String("selector", "id:"+s.LightID))
+}
+
+// name returns the label of the light, or its ID when it has none.
+func (s Sink) name() string {
+	if s.LightLabel != "" {
+		return s.LightLabel
+	}
+	return s.LightID
+}
+
+// show sets the light to the state of the action. last is the state shown before,
+// so an error effect can be stopped when leaving Error.
+func (s Sink) show(log *slog.Logger, lc *lifxutil.Client, action Action, last State) error {
+	light := lifxutil.Light{ID: s.LightID, Label: s.LightLabel}
+
+	if last == Error && action.State != Error {
+		// Stop blinking before setting the new state
+		if err := lc.EffectsOff("id:" + light.ID); err != nil {
+			log.Warn("stop error effect", "selector", "id:"+light.ID, logutil.Err(err))
+		}
+	}
+
+	switch action.State {
+	case Busy:
+		return lc.SetBusyBrightness(light, s.BusyColor, action.Brightness)
+	case Free:
+		return lc.SetFree(light, s.FreeColor)
+	case Team:
+		return lc.SetTeam(light, s.TeamColor)
+	case Error:
+		return lc.SetError(light, s.ErrorColor)
+	case Unknown:
+		return lc.SetUnknown(light, s.UnknownColor)
+	}
+	return fmt.Errorf("no style for state %q", action.State)
+}
+
+// Apply styles every sink for the action. last is the state shown before, so an
+// error effect can be stopped when leaving Error.
+func (m *Manager) Apply(action Action, last State) error {
+	var errs []error
+	for _, s := range m.Snapshot().Sinks {
+		err := s.show(m.logger(), m.lights(s.Token), action, last)
+		metrics.LightCommand(m.backend(s), err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.name(), err))
+		}
+	}
+	err := errors.Join(errs...)
+	m.commanded(time.Now(), err)
+	if err == nil {
+		m.lit(action.State, action.Time)
+	}
+	return err
+}
+
+// Show sets every sink to the state right away, e.g. when shutting down. Any error
+// effect is stopped first since we don't know what the lights were showing.
+func (m *Manager) Show(state State) error {
+	last := Error
+	if state == Error {
+		last = Unknown
+	}
+	return m.Apply(Action{State: state, Time: time.Now()}, last)
+}
+
+// lights returns the client the sinks with the token are driven through, the
+// dry-run recorder if there is one.
+func (m *Manager) lights(token string) *lifxutil.Client {
+	var lc *lifxutil.Client
+	if m.DryRun != nil {
+		lc = m.DryRun.Client(token)
+	} else {
+		lc = lifxutil.NewClient(token)
+	}
+	lc.Log = m.logger()
+	return lc
+}
+
+// lightBudget reports whether any sink's LIFX token is near its rate limit, and
+// how long until all of them have requests left. Dry runs have no limit.
+func (m *Manager) lightBudget(now time.Time) (low bool, wait time.Duration) {
+	if m.DryRun != nil {
+		return false, 0
+	}
+	for _, s := range m.Snapshot().Sinks {
+		l, w := lifxutil.Limits(s.Token).Budget(now)
+		low = low || l
+		wait = max(wait, w)
+	}
+	return low, wait
+}
+
+// backend names what the sink is driven through in metrics.
+func (m *Manager) backend(s Sink) string {
+	if m.DryRun != nil {
+		return "dry_run"
+	}
+	return or(s.Type, "lifx")
+}
+
+// Color returns the color the sink shows for a state.
+func (s Sink) Color(state State) string {
+	switch state {
+	case Busy:
+		return or(s.BusyColor, lifxutil.DefaultBusyColor)
+	case Free:
+		return or(s.FreeColor, lifxutil.DefaultFreeColor)
+	case Team:
+		return or(s.TeamColor, lifxutil.DefaultTeamColor)
+	case Error:
+		return or(s.ErrorColor, lifxutil.DefaultErrorColor)
+	case Unknown:
+		return or(s.UnknownColor, lifxutil.DefaultUnknownColor)
+	}
+	return ""
+}
+
+func or(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
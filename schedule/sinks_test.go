@@ -0,0 +1,93 @@
+package schedule
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"on-air/lifxutil"
+)
+
+func TestActionWorkerDryRun(t *testing.T) {
+	rec := lifxutil.NewRecorder()
+	m := &Manager{
+		Settings: Settings{Sinks: []Sink{
+			{LightID: "d073d5000001", BusyColor: "red"},
+			{LightID: "d073d5000002"},
+		}},
+		DryRun: rec,
+	}
+	ch := make(chan Action)
+	go ActionWorker(ch, m)
+	ch <- Action{State: Error, Time: time.Now()}
+	ch <- Action{State: Busy, Time: time.Now()}
+	close(ch)
+
+	// Two sinks, each with the error breathe, the effects off and the busy state.
+	// The unbuffered channel only tells us the last action was picked up, so wait for the calls.
+	deadline := time.Now().Add(time.Second)
+	for len(rec.Calls()) < 6 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := len(rec.Calls()); n != 6 {
+		t.Fatalf("calls: got %d, want 6", n)
+	}
+	lights := m.Status(time.Now()).Lights
+	if len(lights) != 2 {
+		t.Fatalf("status lights: got %+v, want 2", lights)
+	}
+	if lights[0].Color != "red" || lights[0].Effect != "" {
+		t.Errorf("first light: got %+v, want red without an effect", lights[0])
+	}
+	if lights[1].Color != lifxutil.DefaultBusyColor {
+		t.Errorf("second light: got %+v, want the default busy color", lights[1])
+	}
+}
+
+func TestSinkColor(t *testing.T) {
+	s := Sink{FreeColor: "kelvin:3500"}
+	if got := s.Color(Free); got != "kelvin:3500" {
+		t.Errorf("free: got %q", got)
+	}
+	if got := s.Color(Error); got != lifxutil.DefaultErrorColor {
+		t.Errorf("error: got %q, want the default", got)
+	}
+	if got := (Sink{UnknownColor: "purple"}).Color(Unknown); got != "purple" {
+		t.Errorf("unknown: got %q", got)
+	}
+}
+
+func TestSink_LogValue(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&buf, nil))
+	log.Info("sink", "sink", Sink{Token: "c0ffee", LightID: "d073d5000001"})
+	if out := buf.String(); strings.Contains(out, "c0ffee") || !strings.Contains(out, "sink.selector=id:d073d5000001") {
+		t.Errorf("got %q, want the selector and no token", out)
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	m := &Manager{Settings: Settings{Sinks: []Sink{{Token: "coalesce-token", LightID: "d073d5000001"}}}}
+	ch := make(chan Action, 3)
+	ch <- Action{State: Free}
+	ch <- Action{State: Team}
+	ch <- Action{State: Busy}
+
+	// Plenty of budget, so every command goes out.
+	if got := m.coalesce(ch, Action{State: Error}); got.State != Error || len(ch) != 3 {
+		t.Fatalf("with budget: got %s with %d queued, want error with 3", got.State, len(ch))
+	}
+
+	now := time.Now()
+	lifxutil.Limits("coalesce-token").Update(&http.Response{StatusCode: http.StatusOK, Header: http.Header{
+		"X-Ratelimit-Remaining": {"2"},
+		"X-Ratelimit-Reset":     {strconv.FormatInt(now.Add(time.Minute).Unix(), 10)},
+	}}, now)
+	if got := m.coalesce(ch, Action{State: Error}); got.State != Busy || len(ch) != 0 {
+		t.Errorf("near the limit: got %s with %d queued, want busy with none", got.State, len(ch))
+	}
+}
@@ -0,0 +1,90 @@
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"on-air/fileutil"
+	"on-air/logutil"
+)
+
+// SavedState is what the state file keeps between runs, so a restart doesn't
+// start from an empty schedule while the calendars can't be read.
+type SavedState struct {
+	// Schedule is the last schedule that loaded, at FetchedAt.
+	Schedule  Schedule  `json:"schedule"`
+	FetchedAt time.Time `json:"fetched_at,omitempty"`
+	// Light is the state last shown on the lights, at Shown.
+	Light State     `json:"light,omitempty"`
+	Shown time.Time `json:"shown,omitempty"`
+}
+
+// Restore loads the state file at StatePath, if there is one, so the manager
+// starts with the schedule and light state of the previous run.
+func (m *Manager) Restore() error {
+	if m.StatePath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(m.StatePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var st SavedState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return fmt.Errorf("%s: %w", m.StatePath, err)
+	}
+	m.Lock()
+	m.current = st.Schedule
+	m.saved = st
+	m.Unlock()
+	m.logger().Info("restored state", "path", m.StatePath, "fetched_at", st.FetchedAt, "blocks", len(st.Schedule.Intervals), "state", st.Light)
+	return nil
+}
+
+// shown returns the state last shown on the lights, empty if none is known.
+func (m *Manager) shown() State {
+	m.RLock()
+	defer m.RUnlock()
+	return m.saved.Light
+}
+
+// fetched records a schedule that loaded and saves the state.
+func (m *Manager) fetched(s Schedule, t time.Time) {
+	m.Lock()
+	m.saved.Schedule, m.saved.FetchedAt = s, t
+	m.Unlock()
+	m.persist()
+}
+
+// lit records the state shown on the lights and saves the state.
+func (m *Manager) lit(state State, t time.Time) {
+	m.Lock()
+	m.saved.Light, m.saved.Shown = state, t
+	m.Unlock()
+	m.persist()
+}
+
+// persist writes the saved state to StatePath, if set. It replaces the file
+// atomically so a crash never leaves half a state behind.
+func (m *Manager) persist() {
+	if m.StatePath == "" {
+		return
+	}
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	m.RLock()
+	data, err := json.MarshalIndent(m.saved, "", "  ")
+	m.RUnlock()
+	if err == nil {
+		err = fileutil.WriteFile(m.StatePath, data)
+	}
+	if err != nil {
+		m.logger().Warn("save state", "path", m.StatePath, logutil.Err(err))
+	}
+}
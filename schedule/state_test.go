@@ -0,0 +1,92 @@
+package schedule
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"on-air/lifxutil"
+)
+
+func TestRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	start := time.Now().Add(-time.Minute).Truncate(time.Second)
+	end := time.Now().Add(time.Minute).Truncate(time.Second)
+
+	m := &Manager{StatePath: path}
+	if err := m.Restore(); err != nil {
+		t.Fatalf("restore without a state file: %v", err)
+	}
+	m.fetched(Schedule{Intervals: []TimeBlock{{Start: start, End: end, Calendars: []string{"primary"}}}}, start)
+	if err := m.Apply(Action{State: Busy, Time: start}, Unknown); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := &Manager{StatePath: path}
+	if err := restored.Restore(); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if state, cals := restored.StateAt(time.Now()); state != Busy || len(cals) != 1 {
+		t.Errorf("restored schedule: got %v %v, want busy from primary", state, cals)
+	}
+	if got := restored.shown(); got != Busy {
+		t.Errorf("restored light state: got %q, want busy", got)
+	}
+	if !restored.saved.FetchedAt.Equal(start) {
+		t.Errorf("fetched at: got %v, want %v", restored.saved.FetchedAt, start)
+	}
+}
+
+func TestRestore_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{StatePath: path}
+	if err := m.Restore(); err == nil {
+		t.Error("expected an error for a corrupt state file")
+	}
+}
+
+func TestRestoreReady(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	now := time.Now()
+	prev := &Manager{StatePath: path}
+	prev.fetched(Schedule{Intervals: []TimeBlock{{Start: now.Add(-time.Hour), End: now.Add(time.Hour), State: Busy, Calendars: []string{"primary"}}}}, now.Add(-time.Minute))
+	prev.lit(Busy, now.Add(-time.Minute))
+
+	m := &Manager{
+		StatePath: path,
+		Settings:  Settings{Sinks: []Sink{{LightID: "d073d5000001", BusyColor: "red"}}},
+		DryRun:    lifxutil.NewRecorder(),
+		Clock:     NewVirtualClock(now, now.Add(3*time.Second), 0),
+	}
+	if err := m.Restore(); err != nil {
+		t.Fatal(err)
+	}
+	m.starting(now)
+	m.synced(now)
+
+	// The restored state is sent once at startup, in the current colors.
+	ch := make(chan Action, 10)
+	go Executor(m, ch)
+	var action Action
+	select {
+	case action = <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("no action for the restored state")
+	}
+	if action.State != Busy {
+		t.Fatalf("first action: got %s, want busy", action.State)
+	}
+	if err := m.Apply(action, m.shown()); err != nil {
+		t.Fatal(err)
+	}
+	if h := m.Health(now); !h.Ready || h.Status != Healthy {
+		t.Errorf("health after restoring: got %+v, want ready and ok", h)
+	}
+	if lights := m.Status(now).Lights; len(lights) != 1 || lights[0].Color != "red" {
+		t.Errorf("lights: got %+v, want red", lights)
+	}
+}
@@ -0,0 +1,213 @@
+package schedule
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+
+	"on-air/calendarutil"
+	"on-air/logutil"
+)
+
+const (
+	// channelTTL is how long watch channels are asked to live.
+	channelTTL = 24 * time.Hour
+	// renewBefore is how long before a channel expires it's replaced.
+	renewBefore = time.Hour
+	// watchInterval is how often the channels are checked against the settings and renewed.
+	watchInterval = time.Minute
+)
+
+// channelAPI opens and stops watch channels.
+type channelAPI interface {
+	watch(ctx context.Context, p Person, calID string, ch *calendar.Channel) (*calendar.Channel, error)
+	stop(ctx context.Context, p Person, ch *calendar.Channel) error
+}
+
+// googleChannels is channelAPI on the Google Calendar API.
+type googleChannels struct{}
+
+func (googleChannels) service(ctx context.Context, p Person) (*calendar.Service, error) {
+	client, err := p.client(ctx, p.Scopes()...)
+	if err != nil {
+		return nil, fmt.Errorf("auth client: %w", err)
+	}
+	return calendar.NewService(ctx, option.WithHTTPClient(client))
+}
+
+func (g googleChannels) watch(ctx context.Context, p Person, calID string, ch *calendar.Channel) (*calendar.Channel, error) {
+	svc, err := g.service(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return calendarutil.WatchEvents(ctx, svc, calID, ch)
+}
+
+func (g googleChannels) stop(ctx context.Context, p Person, ch *calendar.Channel) error {
+	svc, err := g.service(ctx, p)
+	if err != nil {
+		return err
+	}
+	return calendarutil.StopChannel(ctx, svc, ch)
+}
+
+// watchChannel is an open channel and when it expires.
+type watchChannel struct {
+	key     calendarKey
+	person  Person
+	ch      *calendar.Channel
+	expires time.Time
+}
+
+// Watcher keeps Google Calendar push notification channels open for every calendar,
+// and reloads the schedule as soon as one of them changes. Polling carries on as
+// before, so a missed notification only delays a change.
+type Watcher struct {
+	m     *Manager
+	url   string // public HTTPS address Google sends notifications to
+	token string // sent back with every notification, so forged ones are refused
+	api   channelAPI
+
+	mu       sync.Mutex
+	channels map[string]*watchChannel // by channel ID
+}
+
+// NewWatcher returns a Watcher for the manager's calendars, with notifications
+// sent to url, which has to reach the Watcher's ServeHTTP.
+func NewWatcher(m *Manager, url string) (*Watcher, error) {
+	token, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	return &Watcher{m: m, url: url, token: token, api: googleChannels{}, channels: make(map[string]*watchChannel)}, nil
+}
+
+// Run opens the channels and keeps them in line with the settings, renewing
+// them before they expire, until ctx is done.
+func (w *Watcher) Run(ctx context.Context) {
+	for {
+		w.sync(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watchInterval):
+		}
+	}
+}
+
+// sync opens channels for calendars that don't have one or whose channel expires
+// soon, then stops the replaced channels and those of calendars no longer configured.
+// Calendars read through free/busy are watched too, their events tell us when the
+// free/busy changes.
+func (w *Watcher) sync(ctx context.Context, now time.Time) {
+	want := make(map[calendarKey]Person)
+	for _, p := range w.m.Snapshot().People {
+		for _, c := range p.Calendars {
+			want[calendarKey{p.Name, c.ID}] = p
+		}
+	}
+
+	w.mu.Lock()
+	var stale []*watchChannel
+	open := make(map[calendarKey]bool)
+	for id, c := range w.channels {
+		if _, ok := want[c.key]; !ok || c.expires.Sub(now) < renewBefore {
+			stale = append(stale, c)
+			delete(w.channels, id)
+			continue
+		}
+		open[c.key] = true
+	}
+	w.mu.Unlock()
+
+	for key, p := range want {
+		if !open[key] {
+			w.open(ctx, key, p, now)
+		}
+	}
+	for _, c := range stale {
+		if err := w.api.stop(ctx, c.person, c.ch); err != nil {
+			w.m.logger().Warn("stop watch channel", "calendar", c.key.calID, logutil.Err(err))
+		}
+	}
+}
+
+// open opens a channel for a calendar. Failures are logged, polling still picks
+// up the changes.
+func (w *Watcher) open(ctx context.Context, key calendarKey, p Person, now time.Time) {
+	id, err := randomID()
+	if err != nil {
+		w.m.logger().Error("watch calendar", "calendar", key.calID, logutil.Err(err))
+		return
+	}
+	ch, err := w.api.watch(ctx, p, key.calID, &calendar.Channel{
+		Id:      id,
+		Type:    "web_hook",
+		Address: w.url,
+		Token:   w.token,
+		Params:  map[string]string{"ttl": strconv.Itoa(int(channelTTL.Seconds()))},
+	})
+	if err != nil {
+		w.m.logger().Warn("watch calendar, falling back to polling", "calendar", key.calID, logutil.Err(err))
+		return
+	}
+	expires := now.Add(channelTTL)
+	if ch.Expiration > 0 {
+		expires = time.UnixMilli(ch.Expiration)
+	}
+	w.mu.Lock()
+	w.channels[id] = &watchChannel{key: key, person: p, ch: ch, expires: expires}
+	w.mu.Unlock()
+	w.m.logger().Info("watching calendar", "calendar", key.calID, "expires", expires)
+}
+
+// Close stops every open channel, so Google stops sending notifications.
+func (w *Watcher) Close(ctx context.Context) {
+	w.mu.Lock()
+	channels := w.channels
+	w.channels = make(map[string]*watchChannel)
+	w.mu.Unlock()
+	for _, c := range channels {
+		if err := w.api.stop(ctx, c.person, c.ch); err != nil {
+			w.m.logger().Warn("stop watch channel", "calendar", c.key.calID, logutil.Err(err))
+		}
+	}
+}
+
+// ServeHTTP receives the notifications. Those of channels we didn't open or with
+// the wrong token are refused; the rest trigger a reload, except for the sync
+// message every new channel starts with.
+func (w *Watcher) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get("X-Goog-Channel-ID")
+	w.mu.Lock()
+	c, ok := w.channels[id]
+	w.mu.Unlock()
+	if !ok || subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Goog-Channel-Token")), []byte(w.token)) != 1 {
+		w.m.logger().Debug("refused notification", "channel", id)
+		http.NotFound(rw, r)
+		return
+	}
+	if state := r.Header.Get("X-Goog-Resource-State"); state != "sync" {
+		w.m.logger().Info("calendar changed, reloading", "calendar", c.key.calID, "resource_state", state)
+		w.m.RequestReload()
+	}
+	rw.WriteHeader(http.StatusOK)
+}
+
+// randomID returns a random ID usable as a channel ID or token.
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,126 @@
+package schedule
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// fakeChannels records the channels opened and stopped.
+type fakeChannels struct {
+	opened  []*calendar.Channel
+	stopped []string
+	calIDs  []string
+}
+
+func (f *fakeChannels) watch(_ context.Context, _ Person, calID string, ch *calendar.Channel) (*calendar.Channel, error) {
+	f.opened = append(f.opened, ch)
+	f.calIDs = append(f.calIDs, calID)
+	return &calendar.Channel{Id: ch.Id, ResourceId: "res-" + calID}, nil
+}
+
+func (f *fakeChannels) stop(_ context.Context, _ Person, ch *calendar.Channel) error {
+	f.stopped = append(f.stopped, ch.Id)
+	return nil
+}
+
+func newTestWatcher(t *testing.T, cals ...Calendar) (*Watcher, *fakeChannels) {
+	t.Helper()
+	m := &Manager{Settings: Settings{People: []Person{{Calendars: cals}}}}
+	w, err := NewWatcher(m, "https://onair.example.com/watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := &fakeChannels{}
+	w.api = api
+	return w, api
+}
+
+// notify sends a synthetic notification like Google's.
+func notify(w *Watcher, channel, token, state string) int {
+	req := httptest.NewRequest("POST", "/watch", nil)
+	req.Header.Set("X-Goog-Channel-ID", channel)
+	req.Header.Set("X-Goog-Channel-Token", token)
+	req.Header.Set("X-Goog-Resource-ID", "res-primary")
+	req.Header.Set("X-Goog-Resource-State", state)
+	req.Header.Set("X-Goog-Message-Number", "1")
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// reloadRequested reports whether a reload is pending, clearing it.
+func reloadRequested(m *Manager) bool {
+	select {
+	case <-m.reloads():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestWatcher_Notifications(t *testing.T) {
+	w, api := newTestWatcher(t, Calendar{ID: "primary", Role: RoleAccepted}, Calendar{ID: "team@example.com", Role: RoleTeam})
+	w.sync(context.Background(), time.Now())
+	if len(api.opened) != 2 {
+		t.Fatalf("opened channels for %v, want every calendar", api.calIDs)
+	}
+	ch := api.opened[0]
+	if ch.Address != "https://onair.example.com/watch" || ch.Type != "web_hook" || ch.Token == "" {
+		t.Errorf("channel: got %+v", ch)
+	}
+
+	if code := notify(w, ch.Id, ch.Token, "sync"); code != http.StatusOK || reloadRequested(w.m) {
+		t.Errorf("sync message: got %d, want 200 without a reload", code)
+	}
+	if code := notify(w, ch.Id, ch.Token, "exists"); code != http.StatusOK || !reloadRequested(w.m) {
+		t.Errorf("change: got %d, want 200 and a reload", code)
+	}
+	if code := notify(w, ch.Id, "forged", "exists"); code != http.StatusNotFound || reloadRequested(w.m) {
+		t.Errorf("wrong token: got %d, want 404 without a reload", code)
+	}
+	if code := notify(w, "someone-elses", ch.Token, "exists"); code != http.StatusNotFound || reloadRequested(w.m) {
+		t.Errorf("unknown channel: got %d, want 404 without a reload", code)
+	}
+}
+
+func TestWatcher_Renew(t *testing.T) {
+	w, api := newTestWatcher(t, Calendar{ID: "primary", Role: RoleAccepted})
+	now := time.Now()
+	w.sync(context.Background(), now)
+	w.sync(context.Background(), now.Add(time.Hour))
+	if len(api.opened) != 1 {
+		t.Fatalf("opened %d channels before expiry, want 1", len(api.opened))
+	}
+
+	old := api.opened[0]
+	w.sync(context.Background(), now.Add(channelTTL-renewBefore/2))
+	if len(api.opened) != 2 || len(api.stopped) != 1 || api.stopped[0] != old.Id {
+		t.Fatalf("renewal: opened %d, stopped %v, want a new channel and the old one stopped", len(api.opened), api.stopped)
+	}
+	if code := notify(w, old.Id, old.Token, "exists"); code != http.StatusNotFound {
+		t.Errorf("old channel: got %d, want 404", code)
+	}
+	if code := notify(w, api.opened[1].Id, api.opened[1].Token, "exists"); code != http.StatusOK {
+		t.Errorf("new channel: got %d, want 200", code)
+	}
+}
+
+func TestWatcher_Reconfigure(t *testing.T) {
+	w, api := newTestWatcher(t, Calendar{ID: "primary", Role: RoleAccepted})
+	w.sync(context.Background(), time.Now())
+	w.m.Reconfigure(Settings{People: []Person{{Calendars: []Calendar{{ID: "other@example.com", Role: RoleAccepted}}}}})
+	w.sync(context.Background(), time.Now())
+	if len(api.opened) != 2 || api.calIDs[1] != "other@example.com" || len(api.stopped) != 1 {
+		t.Errorf("opened %v, stopped %v, want the new calendar watched and the old one stopped", api.calIDs, api.stopped)
+	}
+
+	w.Close(context.Background())
+	if len(api.stopped) != 2 {
+		t.Errorf("close: stopped %v, want every channel", api.stopped)
+	}
+}
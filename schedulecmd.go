@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"on-air/schedule"
+)
+
+// scheduleCommand runs the "schedule" subcommands.
+func scheduleCommand(args []string) {
+	usage := "usage: on-air schedule show [-config path] | on-air schedule agenda [-format text|json|timeline] [-config path]"
+	if len(args) > 0 && args[0] == "agenda" {
+		scheduleAgenda(args[1:])
+		return
+	}
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("schedule show", flag.ExitOnError)
+	configPath := configFlag(fs)
+	settingFlags(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		log.Fatal(err)
+	}
+	manager := &schedule.Manager{Settings: settings(loadConfig(*configPath, fs))}
+	sched, err := manager.LoadSchedule()
+	if err != nil {
+		log.Fatalf("load schedule: %v", err)
+	}
+
+	if len(sched.Intervals) == 0 {
+		fmt.Println("Nothing scheduled")
+		return
+	}
+	for _, b := range sched.Intervals {
+		state := b.State
+		if state == "" {
+			state = schedule.Busy
+		}
+		start, end := b.Start.Local(), b.End.Local()
+		endFormat := "15:04"
+		if end.YearDay() != start.YearDay() || end.Year() != start.Year() {
+			endFormat = "Mon Jan 2 15:04"
+		}
+		line := fmt.Sprintf("%s - %s  %-4s  %s", start.Format("Mon Jan 2 15:04"), end.Format(endFormat), state, strings.Join(b.Calendars, ", "))
+		if b.Person != "" {
+			line += " (" + b.Person + ")"
+		}
+		fmt.Println(line)
+	}
+}
+
+// scheduleAgenda prints the transitions the Executor would fire over the days
+// ahead, with their reasons and colors.
+func scheduleAgenda(args []string) {
+	fs := flag.NewFlagSet("schedule agenda", flag.ExitOnError)
+	configPath := configFlag(fs)
+	format := fs.String("format", "text", "output format: text, json or timeline")
+	settingFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if *format != "text" && *format != "json" && *format != "timeline" {
+		log.Fatalf("unknown format %q, want text, json or timeline", *format)
+	}
+	manager := &schedule.Manager{Settings: settings(loadConfig(*configPath, fs))}
+	sched, err := manager.LoadSchedule()
+	if err != nil {
+		log.Fatalf("load schedule: %v", err)
+	}
+	manager.Update(sched)
+
+	from := time.Now()
+	to := from.Add(time.Duration(manager.Snapshot().Days) * 24 * time.Hour)
+	transitions := manager.Transitions(from, to)
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(struct {
+			From        time.Time             `json:"from"`
+			To          time.Time             `json:"to"`
+			Transitions []schedule.Transition `json:"transitions"`
+		}{from, to, transitions})
+	case "timeline":
+		err = schedule.WriteTimeline(os.Stdout, transitions, from, to)
+	default:
+		err = schedule.WriteAgenda(os.Stdout, transitions)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,154 @@
+// Package secrets stores tokens and keys, either as private plain files or sealed with a local key.
+package secrets
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/nacl/secretbox"
+
+	"on-air/fileutil"
+)
+
+// KeyEnv is the environment variable holding the base64 key for sealed secrets.
+const KeyEnv = "ONAIR_SECRET_KEY"
+
+// Store reads and writes secrets by file path.
+type Store interface {
+	Load(path string) ([]byte, error)
+	Save(path string, data []byte) error
+}
+
+// FileStore keeps secrets as plain files only we can read.
+type FileStore struct{}
+
+// warned holds the paths already warned about, so a reload doesn't warn again.
+var warned sync.Map
+
+// Load reads the secret at path, warning once per path when other users can read it.
+func (FileStore) Load(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		if _, seen := warned.LoadOrStore(path, true); !seen {
+			slog.Warn("secret is readable by other users, run chmod 600 on it", "path", path)
+		}
+	}
+	return os.ReadFile(path)
+}
+
+// Save writes the secret to path with 0600 permissions.
+func (FileStore) Save(path string, data []byte) error {
+	return fileutil.WriteFile(path, data)
+}
+
+// sealedMagic prefixes sealed files so they can be told apart from plain ones.
+var sealedMagic = []byte("on-air sealed v1\n")
+
+// SealedStore keeps secrets in files encrypted with NaCl secretbox.
+type SealedStore struct {
+	Key *[32]byte
+}
+
+// Load reads and decrypts the secret at path. Plain files are returned as is,
+// so existing secrets keep working until they're next saved or sealed.
+func (s SealedStore) Load(path string) ([]byte, error) {
+	data, err := FileStore{}.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, sealedMagic) {
+		return data, nil
+	}
+	data = data[len(sealedMagic):]
+	if len(data) < 24 {
+		return nil, fmt.Errorf("%s: sealed secret is truncated", path)
+	}
+	var nonce [24]byte
+	copy(nonce[:], data[:24])
+	plain, ok := secretbox.Open(nil, data[24:], &nonce, s.Key)
+	if !ok {
+		return nil, fmt.Errorf("%s: can't decrypt secret, wrong key?", path)
+	}
+	return plain, nil
+}
+
+// Save encrypts the secret and writes it to path with 0600 permissions.
+func (s SealedStore) Save(path string, data []byte) error {
+	var nonce [24]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+	out := append([]byte{}, sealedMagic...)
+	out = append(out, nonce[:]...)
+	out = secretbox.Seal(out, data, &nonce, s.Key)
+	return fileutil.WriteFile(path, out)
+}
+
+// NewKey returns a random key for a SealedStore, base64 encoded.
+func NewKey() (string, error) {
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key[:]), nil
+}
+
+// ParseKey decodes a base64 key.
+func ParseKey(s string) (*[32]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("secret key: %w", err)
+	}
+	if len(b) != 32 {
+		return nil, fmt.Errorf("secret key: got %d bytes, want 32", len(b))
+	}
+	var key [32]byte
+	copy(key[:], b)
+	return &key, nil
+}
+
+// LoadKey reads the key from keyFile, or from the KeyEnv variable when keyFile is empty.
+func LoadKey(keyFile string) (*[32]byte, error) {
+	if keyFile != "" {
+		b, err := FileStore{}.Load(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return ParseKey(string(b))
+	}
+	v := os.Getenv(KeyEnv)
+	if v == "" {
+		return nil, fmt.Errorf("secret key: set %s or a key file", KeyEnv)
+	}
+	return ParseKey(v)
+}
+
+// Resolve returns the value a config setting refers to. "env:NAME" reads an environment
+// variable and "file:path" reads a file through the store, anything else is the value itself.
+func Resolve(s Store, value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return v, nil
+	case strings.HasPrefix(value, "file:"):
+		b, err := s.Load(strings.TrimPrefix(value, "file:"))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	return value, nil
+}
@@ -0,0 +1,145 @@
+package secrets
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testKey(t *testing.T) *[32]byte {
+	s, err := NewKey()
+	if err != nil {
+		t.Fatalf("NewKey failed: %v", err)
+	}
+	key, err := ParseKey(s)
+	if err != nil {
+		t.Fatalf("ParseKey failed: %v", err)
+	}
+	return key
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	if err := (FileStore{}).Save(path, []byte("secret")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("permissions: got %v, want 0600", perm)
+	}
+	got, err := FileStore{}.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if string(got) != "secret" {
+		t.Errorf("Load: got %q, want secret", got)
+	}
+}
+
+func TestFileStore_WarnsWhenReadable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	if err := os.WriteFile(path, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	for range 2 {
+		if _, err := (FileStore{}).Load(path); err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+	}
+	if !strings.Contains(buf.String(), "chmod 600") || !strings.Contains(buf.String(), "path="+path) {
+		t.Errorf("got log %q, want a warning about the permissions of %s", buf.String(), path)
+	}
+	if n := strings.Count(buf.String(), "chmod 600"); n != 1 {
+		t.Errorf("warned %d times, want once per path", n)
+	}
+}
+
+func TestSealedStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	store := SealedStore{Key: testKey(t)}
+	if err := store.Save(path, []byte("secret")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read sealed file: %v", err)
+	}
+	if bytes.Contains(raw, []byte("secret")) {
+		t.Error("sealed file contains the plaintext")
+	}
+	got, err := store.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if string(got) != "secret" {
+		t.Errorf("Load: got %q, want secret", got)
+	}
+
+	other := SealedStore{Key: testKey(t)}
+	if _, err := other.Load(path); err == nil {
+		t.Error("expected error loading with the wrong key, got nil")
+	}
+}
+
+func TestSealedStore_PlainFilePassesThrough(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	if err := os.WriteFile(path, []byte("plain"), 0600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	got, err := SealedStore{Key: testKey(t)}.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if string(got) != "plain" {
+		t.Errorf("Load: got %q, want plain", got)
+	}
+}
+
+func TestParseKey_Invalid(t *testing.T) {
+	for _, s := range []string{"not base64!", "c2hvcnQ="} {
+		if _, err := ParseKey(s); err == nil {
+			t.Errorf("ParseKey(%q): expected error, got nil", s)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	t.Setenv("ONAIR_TEST_SECRET", "from-env")
+	path := filepath.Join(t.TempDir(), "lifx_token")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	tests := map[string]string{
+		"literal":               "literal",
+		"env:ONAIR_TEST_SECRET": "from-env",
+		"file:" + path:          "from-file",
+		"":                      "",
+	}
+	for in, want := range tests {
+		got, err := Resolve(FileStore{}, in)
+		if err != nil {
+			t.Errorf("Resolve(%q) failed: %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("Resolve(%q): got %q, want %q", in, got, want)
+		}
+	}
+
+	if _, err := Resolve(FileStore{}, "env:ONAIR_TEST_UNSET"); err == nil {
+		t.Error("expected error for unset environment variable, got nil")
+	}
+	if _, err := Resolve(FileStore{}, "file:"+filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected error for missing file, got nil")
+	}
+}
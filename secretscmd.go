@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"on-air/secrets"
+)
+
+// secretsCommand runs the "secrets" subcommands.
+func secretsCommand(args []string) {
+	usage := "usage: on-air secrets keygen | on-air secrets seal [-key-file path] file..."
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "keygen":
+		key, err := secrets.NewKey()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(key)
+	case "seal":
+		fs := flag.NewFlagSet("secrets seal", flag.ExitOnError)
+		keyFile := fs.String("key-file", "", "file holding the key, else $"+secrets.KeyEnv)
+		if err := fs.Parse(args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		key, err := secrets.LoadKey(*keyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		store := secrets.SealedStore{Key: key}
+		for _, path := range fs.Args() {
+			// Load passes plain files through, so this seals them in place.
+			data, err := store.Load(path)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := store.Save(path, data); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("Sealed %s\n", path)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,58 @@
+// Package server exposes the HTTP endpoints for inspecting a running instance.
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"on-air/logutil"
+	"on-air/metrics"
+	"on-air/schedule"
+)
+
+// Handler returns the HTTP handler serving the endpoints for the manager. More
+// can be added to the mux, e.g. the calendar watch receiver.
+func Handler(m *schedule.Manager) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(m.Status(time.Now())); err != nil {
+			slog.Warn("encode status", logutil.Err(err))
+		}
+	})
+	// healthz fails once the calendars or lights went stale, readyz also until
+	// both worked once.
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		h := m.Health(time.Now())
+		writeHealth(w, h, h.Status != schedule.Degraded)
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		h := m.Health(time.Now())
+		writeHealth(w, h, h.Ready && h.Status != schedule.Degraded)
+	})
+	mux.Handle("GET /metrics", metrics.Handler())
+	return mux
+}
+
+// writeHealth writes the health as JSON, with 503 Service Unavailable unless ok.
+func writeHealth(w http.ResponseWriter, h schedule.Health, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(h); err != nil {
+		slog.Warn("encode health", logutil.Err(err))
+	}
+}
+
+// ListenAndServe serves h, usually from Handler, on addr.
+func ListenAndServe(addr string, h http.Handler) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return srv.ListenAndServe()
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"on-air/schedule"
+)
+
+func TestStatus(t *testing.T) {
+	m := &schedule.Manager{}
+	start := time.Now().Add(-time.Minute)
+	end := time.Now().Add(time.Minute)
+	m.Update(schedule.Schedule{Intervals: []schedule.TimeBlock{
+		{Start: start, End: end, Calendars: []string{"me@example.com"}},
+	}})
+
+	srv := httptest.NewServer(Handler(m))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/status")
+	if err != nil {
+		t.Fatalf("GET /status: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status code: got %d, want 200", resp.StatusCode)
+	}
+	var status schedule.Status
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+	if status.State != schedule.Busy {
+		t.Errorf("State: got %v, want busy", status.State)
+	}
+	if len(status.Calendars) != 1 || status.Calendars[0] != "me@example.com" {
+		t.Errorf("Calendars: got %v, want [me@example.com]", status.Calendars)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	srv := httptest.NewServer(Handler(&schedule.Manager{}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status code: got %d, want 200", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type: got %q, want text/plain", ct)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	m := &schedule.Manager{Settings: schedule.Settings{StaleAfterSeconds: 60}}
+	srv := httptest.NewServer(Handler(m))
+	defer srv.Close()
+
+	get := func(path string) (int, schedule.Health) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		var h schedule.Health
+		if err := json.NewDecoder(resp.Body).Decode(&h); err != nil {
+			t.Fatalf("decode health: %v", err)
+		}
+		return resp.StatusCode, h
+	}
+
+	if code, h := get("/healthz"); code != http.StatusOK || h.Status != schedule.Starting {
+		t.Errorf("healthz before starting: got %d %+v, want 200 starting", code, h)
+	}
+	if code, _ := get("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz before starting: got %d, want 503", code)
+	}
+
+	// The only source can't be loaded, so the first sync never succeeds.
+	m.Reconfigure(schedule.Settings{People: []schedule.Person{{CredsPath: "missing.json", TokenPath: "missing.json"}}, StaleAfterSeconds: 1})
+	_ = m.Reload()
+	time.Sleep(1100 * time.Millisecond)
+	if code, h := get("/healthz"); code != http.StatusServiceUnavailable || h.Status != schedule.Degraded || len(h.Problems) == 0 {
+		t.Errorf("healthz never synced: got %d %+v, want 503 degraded", code, h)
+	}
+}
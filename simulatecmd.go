@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"on-air/lifxutil"
+	"on-air/logutil"
+	"on-air/schedule"
+)
+
+// simEvent is a line of the simulation report: a state change, or a light call it caused.
+type simEvent struct {
+	Transition *schedule.Transition `json:"transition,omitempty"`
+	Call       *lifxutil.Call       `json:"call,omitempty"`
+}
+
+// simulateCommand replays a calendar through the Executor on a virtual clock and
+// reports the states it went through and the light calls it would have made.
+func simulateCommand(args []string) {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	var (
+		configPath = configFlag(fs)
+		fromFlag   = fs.String("from", "", "start of the simulation, e.g. 2026-10-19T08:00 (default today at midnight)")
+		toFlag     = fs.String("to", "", "end of the simulation, a time or just 18:00 on the start day (default a day after the start)")
+		speedFlag  = fs.String("speed", "max", "how much faster than real time to run, e.g. 600x, or max")
+		fixture    = fs.String("fixture", "", "JSON file of blocks to replay instead of reading the calendars")
+		format     = fs.String("format", "text", "report format: text, csv or json")
+		out        = fs.String("out", "", "file to write the report to (default stdout)")
+	)
+	newLogger := logFlags(fs)
+	settingFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	logger := newLogger()
+
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	var err error
+	if *fromFlag != "" {
+		if from, err = parseSimTime(*fromFlag, now); err != nil {
+			log.Fatalf("-from: %v", err)
+		}
+	}
+	to := from.Add(24 * time.Hour)
+	if *toFlag != "" {
+		if to, err = parseSimTime(*toFlag, from); err != nil {
+			log.Fatalf("-to: %v", err)
+		}
+	}
+	if !to.After(from) {
+		log.Fatal("-to must be after -from")
+	}
+	speed, err := parseSpeed(*speedFlag)
+	if err != nil {
+		log.Fatalf("-speed: %v", err)
+	}
+	if *format != "text" && *format != "csv" && *format != "json" {
+		log.Fatalf("unknown format %q, want text, csv or json", *format)
+	}
+
+	clock := schedule.NewVirtualClock(from, to, speed)
+	rec := lifxutil.NewRecorder()
+	rec.Log = logger
+	manager := &schedule.Manager{Settings: settings(loadConfig(*configPath, fs)), DryRun: rec, Clock: clock, Log: logger}
+	if *fixture != "" {
+		blocks, err := loadFixture(*fixture)
+		if err != nil {
+			log.Fatalf("fixture: %v", err)
+		}
+		manager.Update(schedule.Schedule{Intervals: blocks})
+	} else {
+		sched, err := manager.LoadScheduleBetween(from, to)
+		if err != nil {
+			log.Fatalf("load schedule: %v", err)
+		}
+		manager.Update(sched)
+	}
+
+	events := simulate(manager, clock, rec)
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(struct {
+			From   time.Time  `json:"from"`
+			To     time.Time  `json:"to"`
+			Events []simEvent `json:"events"`
+		}{from, to, events})
+	case "csv":
+		err = writeSimCSV(w, events, time.Local)
+	default:
+		err = writeSimText(w, events, time.Local)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// simulate runs the Executor on the virtual clock until it's done, sending every
+// action to the recorder, and returns the states it went through and the calls
+// they caused.
+func simulate(manager *schedule.Manager, clock *schedule.VirtualClock, rec *lifxutil.Recorder) []simEvent {
+	// Calls are stamped with the virtual time of the action causing them.
+	var actionTime time.Time
+	rec.Now = func() time.Time { return actionTime }
+
+	ch := make(chan schedule.Action)
+	go schedule.Executor(manager, ch)
+	var events []simEvent
+	last := schedule.Unknown
+	for {
+		select {
+		case action := <-ch:
+			actionTime = action.Time
+			tr := manager.Describe(action)
+			events = append(events, simEvent{Transition: &tr})
+			seen := len(rec.Calls())
+			if err := manager.Apply(action, last); err != nil {
+				logutil.Or(manager.Log).Error("set lights", "state", action.State, "at", action.Time.Format(time.RFC3339), logutil.Err(err))
+			}
+			for _, call := range rec.Calls()[seen:] {
+				events = append(events, simEvent{Call: &call})
+			}
+			last = action.State
+		case <-clock.Done():
+			return events
+		}
+	}
+}
+
+// parseSimTime parses a simulation time in local time. A bare clock time is on the day of base.
+func parseSimTime(s string, base time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.ParseInLocation("15:04", s, time.Local); err == nil {
+		base = base.Local()
+		return time.Date(base.Year(), base.Month(), base.Day(), t.Hour(), t.Minute(), 0, 0, time.Local), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a time like 2026-10-19T08:00 or 18:00", s)
+}
+
+// parseSpeed parses a speed like 600x, max meaning as fast as possible (0).
+func parseSpeed(s string) (float64, error) {
+	if s == "max" {
+		return 0, nil
+	}
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(s, "x"), 64)
+	if err != nil || speed <= 0 {
+		return 0, fmt.Errorf("%q is not a speed like 600x or max", s)
+	}
+	return speed, nil
+}
+
+// loadFixture reads blocks from a JSON file, e.g.
+// [{"start": "2026-10-19T09:00:00+02:00", "end": "2026-10-19T10:00:00+02:00", "state": "busy", "calendars": ["primary"]}]
+func loadFixture(path string) ([]schedule.TimeBlock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var blocks []schedule.TimeBlock
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// writeSimText writes the simulated transitions and light calls as text, with
+// times in loc.
+func writeSimText(w io.Writer, events []simEvent, loc *time.Location) error {
+	for _, e := range events {
+		var err error
+		if t := e.Transition; t != nil {
+			line := fmt.Sprintf("%s  %-5s", t.Time.In(loc).Format("2006-01-02 15:04:05"), t.State)
+			if t.Brightness > 0 {
+				line += fmt.Sprintf(" %.0f%%", t.Brightness*100)
+			}
+			if len(t.Calendars) > 0 {
+				line += "  " + strings.Join(t.Calendars, ", ")
+			}
+			if len(t.People) > 0 {
+				line += " (" + strings.Join(t.People, ", ") + ")"
+			}
+			_, err = fmt.Fprintln(w, strings.TrimRight(line, " "))
+		} else {
+			body, _ := json.Marshal(e.Call.Body)
+			_, err = fmt.Fprintf(w, "    %s %s %s\n", e.Call.Method, e.Call.URL, body)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSimCSV writes the simulated transitions and light calls as CSV, with
+// RFC 3339 times in loc.
+func writeSimCSV(w io.Writer, events []simEvent, loc *time.Location) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"time", "kind", "state", "brightness", "calendars", "people", "method", "url", "body"}); err != nil {
+		return err
+	}
+	for _, e := range events {
+		var row []string
+		if t := e.Transition; t != nil {
+			row = []string{t.Time.In(loc).Format(time.RFC3339), "state", string(t.State), strconv.FormatFloat(t.Brightness, 'f', -1, 64),
+				strings.Join(t.Calendars, " "), strings.Join(t.People, " "), "", "", ""}
+		} else {
+			body, _ := json.Marshal(e.Call.Body)
+			row = []string{e.Call.Time.In(loc).Format(time.RFC3339), "call", "", "", "", "", e.Call.Method, e.Call.URL, string(body)}
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
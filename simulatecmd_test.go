@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"on-air/lifxutil"
+	"on-air/schedule"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestParseSimTime(t *testing.T) {
+	base := time.Date(2026, 10, 19, 8, 0, 0, 0, time.Local)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2026-10-19T08:00", time.Date(2026, 10, 19, 8, 0, 0, 0, time.Local)},
+		{"2026-10-19T08:00:30", time.Date(2026, 10, 19, 8, 0, 30, 0, time.Local)},
+		{"2026-10-20", time.Date(2026, 10, 20, 0, 0, 0, 0, time.Local)},
+		{"2026-10-19T08:00:00Z", time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)},
+		{"18:00", time.Date(2026, 10, 19, 18, 0, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		got, err := parseSimTime(tt.in, base)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseSimTime(%q): got %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "tomorrow", "25:00", "2026-13-01"} {
+		if _, err := parseSimTime(in, base); err == nil {
+			t.Errorf("parseSimTime(%q): expected an error", in)
+		}
+	}
+}
+
+func TestParseSpeed(t *testing.T) {
+	tests := map[string]float64{"max": 0, "600x": 600, "1": 1, "0.5x": 0.5}
+	for in, want := range tests {
+		if got, err := parseSpeed(in); err != nil || got != want {
+			t.Errorf("parseSpeed(%q): got %v, %v, want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "fast", "0x", "-2x", "x"} {
+		if _, err := parseSpeed(in); err == nil {
+			t.Errorf("parseSpeed(%q): expected an error", in)
+		}
+	}
+}
+
+// TestSimulateReports replays testdata/simulate/fixture.json and compares the
+// reports with the golden files. Run with -update to rewrite them.
+func TestSimulateReports(t *testing.T) {
+	blocks, err := loadFixture(filepath.Join("testdata", "simulate", "fixture.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	clock := schedule.NewVirtualClock(from, from.Add(4*time.Hour), 0)
+	rec := lifxutil.NewRecorder()
+	rec.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	manager := &schedule.Manager{
+		Settings: schedule.Settings{Sinks: []schedule.Sink{{LightID: "d073d5000001", BusyColor: "red"}}},
+		DryRun:   rec,
+		Clock:    clock,
+		Log:      rec.Log,
+	}
+	manager.Update(schedule.Schedule{Intervals: blocks})
+	events := simulate(manager, clock, rec)
+
+	for _, report := range []struct {
+		name  string
+		write func(w *bytes.Buffer) error
+	}{
+		{"report.txt", func(w *bytes.Buffer) error { return writeSimText(w, events, time.UTC) }},
+		{"report.csv", func(w *bytes.Buffer) error { return writeSimCSV(w, events, time.UTC) }},
+	} {
+		var got bytes.Buffer
+		if err := report.write(&got); err != nil {
+			t.Fatalf("%s: %v", report.name, err)
+		}
+		golden := filepath.Join("testdata", "simulate", report.name)
+		if *update {
+			if err := os.WriteFile(golden, got.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), want) {
+			t.Errorf("%s differs from %s:\n%s", report.name, golden, got.String())
+		}
+	}
+}
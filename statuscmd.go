@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"on-air/configutil"
+	"on-air/schedule"
+)
+
+// statusCommand asks a running instance for its state over its status endpoint.
+func statusCommand(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	var (
+		configPath = configFlag(fs)
+		addr       = fs.String("addr", "", "status address of the running instance, defaults to status_addr from the config")
+		asJSON     = fs.Bool("json", false, "print the raw status JSON")
+	)
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+
+	if *addr == "" {
+		cfg, err := configutil.Load(*configPath, os.Environ(), nil)
+		if err != nil {
+			log.Fatalf("failed to load config: %v", err)
+		}
+		if cfg.StatusAddr == "" {
+			log.Fatal("status_addr isn't set, so a running instance can't be asked; set it or pass -addr")
+		}
+		*addr = cfg.StatusAddr
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get("http://" + *addr + "/status")
+	if err != nil {
+		log.Fatalf("on-air isn't answering on %s: %v", *addr, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalf("status: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if *asJSON {
+		fmt.Println(strings.TrimSpace(string(body)))
+		return
+	}
+
+	var status schedule.Status
+	if err := json.Unmarshal(body, &status); err != nil {
+		log.Fatalf("decode status: %v", err)
+	}
+	fmt.Printf("State:     %s\n", status.State)
+	if len(status.Calendars) > 0 {
+		fmt.Printf("Calendars: %s\n", strings.Join(status.Calendars, ", "))
+	}
+	if len(status.People) > 0 {
+		fmt.Printf("People:    %s\n", strings.Join(status.People, ", "))
+	}
+	if status.Error != "" {
+		fmt.Printf("Error:     %s\n", status.Error)
+	}
+	fmt.Printf("As of:     %s\n", status.Time.Local().Format(time.RFC1123))
+	if len(status.Lights) > 0 {
+		fmt.Println("Dry run, the lights would be:")
+		for _, l := range status.Lights {
+			line := fmt.Sprintf("  %s  %s %s", l.Selector, l.Power, l.Color)
+			if l.Brightness > 0 {
+				line += fmt.Sprintf(" brightness:%.2f", l.Brightness)
+			}
+			if l.Effect != "" {
+				line += " (" + l.Effect + ")"
+			}
+			fmt.Println(line)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+
+	"on-air/schedule"
+)
+
+// watch mounts a receiver for Google Calendar push notifications on mux, at the
+// path of the public watchURL, and starts opening channels for the calendars.
+// The config was validated, so watchURL parses.
+func watch(mux *http.ServeMux, m *schedule.Manager, watchURL string) *schedule.Watcher {
+	w, err := schedule.NewWatcher(m, watchURL)
+	if err != nil {
+		log.Fatalf("watch calendars: %v", err)
+	}
+	u, _ := url.Parse(watchURL)
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	mux.Handle("POST "+path, w)
+	go w.Run(context.Background())
+	return w
+}